@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	flag "github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// locationsKey holds the locations in a profile, all other keys are flag names
+const locationsKey = "locations"
+
+// configFile holds settings shared by all profiles and the named profiles.
+// Settings are keyed by their flag name without the leading dashes.
+type configFile struct {
+	Defaults map[string]interface{}            `yaml:"defaults" toml:"defaults"`
+	Profiles map[string]map[string]interface{} `yaml:"profiles" toml:"profiles"`
+}
+
+func loadConfigFile(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &configFile{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		_, err = toml.Decode(string(data), c)
+	default:
+		err = yaml.Unmarshal(data, c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config '%s': %w", path, err)
+	}
+	return c, nil
+}
+
+// applyConfig sets all flags not given on the command line from the defaults and the profile of
+// the config file. It returns the locations of the profile.
+func applyConfig(fs *flag.FlagSet, path, profile string) ([]string, error) {
+	c, err := loadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]interface{}{}
+	for k, v := range c.Defaults {
+		settings[k] = v
+	}
+	if profile != "" {
+		p, set := c.Profiles[profile]
+		if !set {
+			names := []string{}
+			for n := range c.Profiles {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("profile '%s' not found in '%s', known profiles: %v", profile, path, names)
+		}
+		for k, v := range p {
+			settings[k] = v
+		}
+	}
+
+	locations, err := toStrings(settings[locationsKey])
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", locationsKey, err)
+	}
+	delete(settings, locationsKey)
+
+	for name, v := range settings {
+		f := fs.Lookup(name)
+		if f == nil || name == "config" || name == "profile" {
+			return nil, fmt.Errorf("'%s' in '%s' is not a known setting", name, path)
+		}
+		// flags given on the command line win
+		if f.Changed {
+			continue
+		}
+		values, err := toStrings(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		// replace slices as a whole, Set would split the values on commas
+		if sv, ok := f.Value.(flag.SliceValue); ok {
+			if err := sv.Replace(values); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		}
+		if len(values) != 1 {
+			return nil, fmt.Errorf("%s: expected a single value, got %v", name, values)
+		}
+		if err := f.Value.Set(values[0]); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return locations, nil
+}
+
+func toStrings(v interface{}) ([]string, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		s := []string{}
+		for _, e := range t {
+			switch e.(type) {
+			case []interface{}, map[string]interface{}:
+				return nil, fmt.Errorf("nested values are not supported")
+			}
+			s = append(s, fmt.Sprint(e))
+		}
+		return s, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("nested values are not supported")
+	}
+	return []string{fmt.Sprint(v)}, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+	"github.com/floj/logs2goaccess/sink"
+)
+
+// goaccessProcess feeds the output into goaccess. Either the output is streamed to the stdin of a
+// single goaccess process, or it is written to a spool file and goaccess is rerun on it every
+// interval, e.g. to keep an HTML report up to date.
+type goaccessProcess struct {
+	bin  string
+	args []string
+
+	// streaming
+	stdin io.WriteCloser
+
+	// rerunning
+	spool       *os.File
+	removeSpool bool
+	stop        chan struct{}
+	stopped     chan struct{}
+
+	mu sync.Mutex
+	// the running goaccess process
+	cmd *exec.Cmd
+	// writes the buffered output to the spool file before goaccess is rerun
+	flush func() error
+}
+
+// spoolSink guards the sink writing the spool file, so it can be flushed while the pipeline runs
+type spoolSink struct {
+	mu sync.Mutex
+	*sink.GoAccess
+}
+
+func (s *spoolSink) Write(l *goaccess.Line) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.GoAccess.Write(l)
+}
+
+func (s *spoolSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.GoAccess.Flush()
+}
+
+func (s *spoolSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.GoAccess.Close()
+}
+
+func goaccessArgs(layout goaccess.Layout, extra []string) []string {
+	args := []string{
+		"--log-format=" + layout.LineFormat(),
+		"--date-format=" + goaccess.DateFormat,
+		"--time-format=" + goaccess.TimeFormat,
+	}
+	return append(args, extra...)
+}
+
+// streamToGoAccess starts goaccess reading from the returned writer
+func streamToGoAccess(bin string, args []string) (*goaccessProcess, io.Writer, error) {
+	p := &goaccessProcess{bin: bin, args: args}
+	cmd := p.command("-")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("could not start goaccess: %w", err)
+	}
+	p.stdin = stdin
+	p.cmd = cmd
+	return p, stdin, nil
+}
+
+// rerunGoAccess runs goaccess on spool every interval until Wait is called
+func rerunGoAccess(bin string, args []string, spool *os.File, removeSpool bool, interval time.Duration) *goaccessProcess {
+	p := &goaccessProcess{
+		bin:         bin,
+		args:        args,
+		spool:       spool,
+		removeSpool: removeSpool,
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go func() {
+		defer close(p.stopped)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-t.C:
+				if code, err := p.runOnce(); err != nil || code != 0 {
+					fmt.Fprintf(os.Stderr, "goaccess failed (exit code %d): %v\n", code, err)
+				}
+			}
+		}
+	}()
+	return p
+}
+
+func (p *goaccessProcess) command(input string) *exec.Cmd {
+	cmd := exec.Command(p.bin, append(append([]string{}, p.args...), input)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+// FlushWith sets the function writing the buffered output to the spool file before every rerun
+func (p *goaccessProcess) FlushWith(flush func() error) {
+	p.mu.Lock()
+	p.flush = flush
+	p.mu.Unlock()
+}
+
+func (p *goaccessProcess) runOnce() (int, error) {
+	p.mu.Lock()
+	flush := p.flush
+	p.mu.Unlock()
+	if flush != nil {
+		// goaccess would otherwise see a truncated last line
+		if err := flush(); err != nil {
+			return 0, fmt.Errorf("could not flush the output: %w", err)
+		}
+	}
+
+	cmd := p.command(p.spool.Name())
+	p.mu.Lock()
+	err := cmd.Start()
+	if err == nil {
+		p.cmd = cmd
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("could not start goaccess: %w", err)
+	}
+	err = cmd.Wait()
+	p.mu.Lock()
+	p.cmd = nil
+	p.mu.Unlock()
+	return exitCode(err)
+}
+
+// Signal forwards s to the running goaccess process. SIGINT is not forwarded if goaccess is in
+// the same process group, the terminal already sent it to the whole group.
+func (p *goaccessProcess) Signal(s os.Signal) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cmd != nil {
+		if s == os.Interrupt && inProcessGroup(p.cmd.Process.Pid) {
+			return
+		}
+		// fails if the process already exited, which is fine
+		p.cmd.Process.Signal(s)
+	}
+}
+
+// Wait signals goaccess the end of the output and waits for it to exit. When rerunning,
+// goaccess is run a last time if final is set. It returns the exit code of goaccess.
+func (p *goaccessProcess) Wait(final bool) (int, error) {
+	if p.stdin != nil {
+		p.stdin.Close()
+		return exitCode(p.cmd.Wait())
+	}
+
+	close(p.stop)
+	<-p.stopped
+	if p.removeSpool {
+		defer os.Remove(p.spool.Name())
+	}
+	if !final {
+		return 0, nil
+	}
+	return p.runOnce()
+}
+
+// exitCode returns the exit code of a finished process, processes killed by a signal exit with 128+signal
+func exitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 0, err
+	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal()), nil
+	}
+	return exitErr.ExitCode(), nil
+}
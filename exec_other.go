@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// inProcessGroup reports whether the process pid is in the process group of this process,
+// there are no process groups on this platform
+func inProcessGroup(pid int) bool {
+	return false
+}
@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// inProcessGroup reports whether the process pid is in the process group of this process
+func inProcessGroup(pid int) bool {
+	pgid, err := syscall.Getpgid(pid)
+	return err == nil && pgid == syscall.Getpgrp()
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -16,11 +17,11 @@ import (
 var cwLogsClientOnce sync.Once
 var cwLogsClient *cloudwatchlogs.Client
 
-func getCwLogsClient() (*cloudwatchlogs.Client, error) {
+func getCwLogsClient(ctx context.Context) (*cloudwatchlogs.Client, error) {
 	var err error
 	cwLogsClientOnce.Do(func() {
 		var cfg aws.Config
-		cfg, err = config.LoadDefaultConfig(context.Background())
+		cfg, err = config.LoadDefaultConfig(ctx)
 		if err != nil {
 			return
 		}
@@ -29,11 +30,13 @@ func getCwLogsClient() (*cloudwatchlogs.Client, error) {
 	return cwLogsClient, err
 }
 
-func cwLogsResolver(loc string) ([]string, error) {
-	return []string{loc}, nil
+func cwLogsResolver(ctx context.Context, loc string, o Options) ([]Location, error) {
+	return []Location{{Name: loc, Size: -1}}, nil
 }
 
 type cwlReader struct {
+	ctx   context.Context
+	retry RetryPolicy
 	pager *cloudwatchlogs.FilterLogEventsPaginator
 	mr    io.Reader
 }
@@ -47,7 +50,12 @@ func (r *cwlReader) Read(p []byte) (int, error) {
 		if !r.pager.HasMorePages() {
 			return 0, io.EOF
 		}
-		page, err := r.pager.NextPage(context.Background())
+		var page *cloudwatchlogs.FilterLogEventsOutput
+		err := r.retry.do(r.ctx, "fetching log events", func() error {
+			var err error
+			page, err = r.pager.NextPage(r.ctx)
+			return err
+		})
 		if err != nil {
 			return 0, err
 		}
@@ -66,9 +74,9 @@ func (r *cwlReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
-func cwLogsReader(loc string, fc filter.FilterConf) (io.ReadCloser, error) {
+func cwLogsReader(ctx context.Context, loc string, o Options) (io.ReadCloser, error) {
 	group := strings.TrimPrefix(loc, "cwlogs:")
-	c, err := getCwLogsClient()
+	c, err := getCwLogsClient(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -76,14 +84,37 @@ func cwLogsReader(loc string, fc filter.FilterConf) (io.ReadCloser, error) {
 	req := &cloudwatchlogs.FilterLogEventsInput{
 		LogGroupName: &group,
 	}
-	if fc.DateAfter != nil {
-		req.StartTime = aws.Int64(fc.DateAfter.UnixMilli())
+	after, before := filter.TimeWindow(o.Predicate)
+	if after != nil {
+		req.StartTime = aws.Int64(after.UnixMilli())
 	}
-	if fc.DateBefore != nil {
-		req.EndTime = aws.Int64(fc.DateBefore.UnixMilli())
+	if before != nil {
+		req.EndTime = aws.Int64(before.UnixMilli())
+	}
+	if pattern := cwLogsFilterPattern(o.Predicate); pattern != "" {
+		req.FilterPattern = &pattern
 	}
 	pager := cloudwatchlogs.NewFilterLogEventsPaginator(c, req)
 
-	return &cwlReader{pager: pager}, nil
+	return &cwlReader{ctx: ctx, retry: o.retry(), pager: pager}, nil
+
+}
 
+// cwLogsFilterPattern translates the substrings required by p into a CloudWatch filter pattern.
+// A pattern can either require all or any of its terms, so only the first group is pushed down,
+// the remaining ones are checked after fetching anyways.
+func cwLogsFilterPattern(p filter.Predicate) string {
+	groups := filter.RequiredSubstrings(p)
+	if len(groups) == 0 {
+		return ""
+	}
+	terms := []string{}
+	for _, s := range groups[0] {
+		if len(groups[0]) == 1 {
+			terms = append(terms, strconv.Quote(s))
+			continue
+		}
+		terms = append(terms, "?"+strconv.Quote(s))
+	}
+	return strings.Join(terms, " ")
 }
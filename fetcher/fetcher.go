@@ -3,45 +3,147 @@ package fetcher
 import (
 	"bufio"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/floj/logs2goaccess/filter"
 )
 
 type Fetcher interface {
 	io.Closer
-	Next() (line string, lineRead bool, err error)
+	Next(ctx context.Context) (line string, lineRead bool, err error)
+}
+
+// Options configure how locations are read
+type Options struct {
+	// Predicate may be used to skip data which can not match
+	Predicate filter.Predicate
+	// Retry is used for failed requests and locations failing while being read
+	Retry RetryPolicy
+	// OnError decides what happens if a location can not be read after all retries
+	OnError ErrorPolicy
+}
+
+func (o Options) retry() RetryPolicy {
+	if o.OnError == OnErrorFail {
+		return RetryPolicy{Attempts: 1}
+	}
+	return o.Retry
 }
 
 type FetcherImpl struct {
 	locations []string
-	fc        filter.FilterConf
+	o         Options
 
 	current io.ReadCloser
 	s       *bufio.Scanner
+
+	// progress of the fetcher, see Progress
+	completed []string
+	line      int
+	// lines to skip of the first location when resuming or retrying
+	skip int
+	// failed attempts to read the current location
+	failures int
+	skipped  []SkippedLocation
+}
+
+// SkippedLocation is a location which could not be read and was skipped due to OnErrorSkip
+type SkippedLocation struct {
+	Location string
+	Err      error
+}
+
+// Progress describes how far a fetcher got, it can be used to resume later on
+type Progress struct {
+	Completed []string `json:"completed"`
+	Current   string   `json:"current,omitempty"`
+	// number of lines of Current already returned
+	Line int `json:"line,omitempty"`
 }
 
 func (f *FetcherImpl) Close() error {
 	if f.current == nil {
 		return nil
 	}
-	return f.Close()
+	err := f.current.Close()
+	f.current = nil
+	f.s = nil
+	return err
 }
 
-type locationResolver func(s string) ([]string, error)
+// Progress returns the locations read completely and the number of lines read from the current one
+func (f *FetcherImpl) Progress() Progress {
+	p := Progress{Completed: append([]string{}, f.completed...)}
+	if len(f.locations) > 0 && f.line > 0 {
+		p.Current = f.locations[0]
+		p.Line = f.line
+	}
+	return p
+}
+
+// Position returns the location and the number of the line last returned by Next
+func (f *FetcherImpl) Position() (string, int) {
+	if len(f.locations) == 0 {
+		return "", 0
+	}
+	return f.locations[0], f.line
+}
 
-var factories = map[string]func(string, filter.FilterConf) (io.ReadCloser, error){
+// Resume skips the locations and lines already read according to p.
+// It has to be called before the first call to Next.
+func (f *FetcherImpl) Resume(p Progress) {
+	done := map[string]bool{}
+	for _, l := range p.Completed {
+		done[l] = true
+	}
+	locs := []string{}
+	for _, l := range f.locations {
+		if !done[l] {
+			locs = append(locs, l)
+		}
+	}
+	f.locations = locs
+	f.completed = append([]string{}, p.Completed...)
+	if len(locs) > 0 && locs[0] == p.Current {
+		f.skip = p.Line
+	}
+}
+
+// Skipped returns the locations skipped so far
+func (f *FetcherImpl) Skipped() []SkippedLocation {
+	return append([]SkippedLocation{}, f.skipped...)
+}
+
+// Location is a resolved location with the metadata known without reading it
+type Location struct {
+	Name string
+	// Size in bytes, -1 if unknown
+	Size int64
+	// LastModified is the zero time if unknown
+	LastModified time.Time
+}
+
+// TimeRange guesses the time range of the logs in the location by its name
+func (l Location) TimeRange() (from time.Time, to time.Time, ok bool) {
+	return inferKeyTimeRange(l.Name)
+}
+
+type locationResolver func(ctx context.Context, s string, o Options) ([]Location, error)
+
+var factories = map[string]func(context.Context, string, Options) (io.ReadCloser, error){
 	"file:":   fileReader,
 	"s3:":     s3Reader,
 	"cwlogs:": cwLogsReader,
 }
 
-var locationResolvers = map[string]func(s string) ([]string, error){
+var locationResolvers = map[string]locationResolver{
 	"file:":  fileResolver,
 	"s3:":    s3LocationResolver,
 	"cwlogs": cwLogsResolver,
@@ -79,8 +181,31 @@ func resolverFor(loc string) (locationResolver, bool) {
 	return nil, false
 }
 
-func ForLocations(locations []string, fc filter.FilterConf) (Fetcher, error) {
+// ForLocations resolves the locations and returns a Fetcher reading them one after another
+func ForLocations(ctx context.Context, locations []string, o Options) (*FetcherImpl, error) {
+	if o.Predicate == nil {
+		o.Predicate = filter.All{}
+	}
+	resolved, err := Resolve(ctx, locations, o)
+	if err != nil {
+		return nil, err
+	}
 	locs := []string{}
+	for _, l := range resolved {
+		locs = append(locs, l.Name)
+	}
+	return &FetcherImpl{
+		locations: locs,
+		o:         o,
+	}, nil
+}
+
+// Resolve expands the locations (e.g. s3:recurse:...) into the single locations to read, without reading them
+func Resolve(ctx context.Context, locations []string, o Options) ([]Location, error) {
+	if o.Predicate == nil {
+		o.Predicate = filter.All{}
+	}
+	locs := []Location{}
 	for _, loc := range locations {
 		resolver, set := resolverFor(loc)
 		if !set {
@@ -90,59 +215,162 @@ func ForLocations(locations []string, fc filter.FilterConf) (Fetcher, error) {
 			}
 			return nil, fmt.Errorf("no location resolver for '%s' present, known resolvers: %v", loc, validResolvers)
 		}
-		resolved, err := resolver(loc)
+		resolved, err := resolver(ctx, loc, o)
 		if err != nil {
 			return nil, err
 		}
 		locs = append(locs, resolved...)
 	}
-	return &FetcherImpl{
-		locations: locs,
-		fc:        fc,
-	}, nil
+	return locs, nil
 }
 
-func (f *FetcherImpl) Next() (string, bool, error) {
-	if len(f.locations) == 0 {
-		return "", false, nil
-	}
-	if f.s == nil {
-		r, err := open(f.locations[0], f.fc)
-		if err != nil {
+func (f *FetcherImpl) Next(ctx context.Context) (string, bool, error) {
+	for len(f.locations) > 0 {
+		if f.s == nil {
+			r, err := open(ctx, f.locations[0], f.o)
+			if err != nil {
+				if ferr := f.fail(ctx, err); ferr != nil {
+					return "", false, ferr
+				}
+				continue
+			}
+			f.current = r
+			f.s = newLineScanner(r)
+			f.line = 0
+		}
+		if f.s.Scan() {
+			f.line++
+			if f.line <= f.skip {
+				continue
+			}
+			f.failures = 0
+			return f.s.Text(), true, nil
+		}
+		if err := f.s.Err(); err != nil {
+			if ferr := f.fail(ctx, err); ferr != nil {
+				return "", false, ferr
+			}
+			continue
+		}
+		if err := f.Close(); err != nil {
 			return "", false, err
 		}
-		f.current = r
-		f.s = bufio.NewScanner(r)
+		f.done()
 	}
-	if f.s.Scan() {
-		return f.s.Text(), true, nil
+	return "", false, nil
+}
+
+// done moves on to the next location
+func (f *FetcherImpl) done() {
+	f.completed = append(f.completed, f.locations[0])
+	f.locations = f.locations[1:]
+	f.line = 0
+	f.skip = 0
+	f.failures = 0
+}
+
+// fail handles an error reading the current location according to the error policy. If the
+// location should be retried, it is reopened skipping the lines already returned. Errors which
+// should abort the fetcher are returned.
+func (f *FetcherImpl) fail(ctx context.Context, err error) error {
+	loc := f.locations[0]
+	f.Close()
+	if ctx.Err() != nil {
+		return ctx.Err()
 	}
-	if f.s.Err() != nil {
-		return "", false, f.s.Err()
+	err = fmt.Errorf("reading %s failed: %w", loc, err)
+
+	retry := f.o.retry()
+	f.failures++
+	if f.failures < retry.Attempts {
+		d := retry.delay(f.failures - 1)
+		fmt.Fprintf(os.Stderr, "%v (attempt %d/%d), retrying in %s\n", err, f.failures, retry.Attempts, d.Round(time.Millisecond))
+		// lines already returned are skipped when reopening
+		if f.line > f.skip {
+			f.skip = f.line
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
 	}
-	if err := f.current.Close(); err != nil {
-		return "", false, err
+
+	if f.o.OnError != OnErrorSkip {
+		return err
 	}
-	f.current = nil
-	f.s = nil
-	f.locations = f.locations[1:]
-	return f.Next()
+	fmt.Fprintf(os.Stderr, "%v, skipping\n", err)
+	f.skipped = append(f.skipped, SkippedLocation{Location: loc, Err: err})
+	f.done()
+	return nil
+}
+
+// newLineScanner returns a scanner that drops a trailing partial line if reading failed, so the
+// line is not returned half and can be read again after reopening
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	t := &errTracker{Reader: r}
+	s := bufio.NewScanner(t)
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && t.err != nil {
+			// complete lines are still fine
+			if adv, tok, err := bufio.ScanLines(data, false); adv > 0 || err != nil {
+				return adv, tok, err
+			}
+			return 0, nil, t.err
+		}
+		return bufio.ScanLines(data, atEOF)
+	})
+	return s
+}
+
+// errTracker remembers the last error other than io.EOF
+type errTracker struct {
+	io.Reader
+	err error
+}
+
+func (t *errTracker) Read(p []byte) (int, error) {
+	n, err := t.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		t.err = err
+	}
+	return n, err
 }
 
 func wrapGzipIfRequired(in io.ReadCloser, name string) (io.ReadCloser, error) {
 	ext := filepath.Ext(name)
-	if strings.ToLower(ext) == ".gz" {
-		return gzip.NewReader(in)
+	if strings.ToLower(ext) != ".gz" {
+		return in, nil
+	}
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	return &gzipReadCloser{Reader: gz, in: in}, nil
+}
+
+// gzipReadCloser closes the underlying reader as well, gzip.Reader.Close does not
+type gzipReadCloser struct {
+	*gzip.Reader
+	in io.Closer
+}
+
+func (r *gzipReadCloser) Close() error {
+	err := r.Reader.Close()
+	if cerr := r.in.Close(); err == nil {
+		err = cerr
 	}
-	return in, nil
+	return err
 }
 
-func open(location string, fc filter.FilterConf) (io.ReadCloser, error) {
+func open(ctx context.Context, location string, o Options) (io.ReadCloser, error) {
 	fmt.Fprintf(os.Stderr, "opening %s\n", location)
 	for p, fn := range factories {
 		if strings.HasPrefix(location, p) {
 			s := strings.TrimPrefix(location, p)
-			return fn(s, fc)
+			return fn(ctx, s, o)
 		}
 	}
 
@@ -156,7 +384,12 @@ func open(location string, fc filter.FilterConf) (io.ReadCloser, error) {
 type matcher func(string) bool
 
 func newMatcher(def string) (matcher, error) {
+	// rexexp: was the only accepted spelling in earlier versions
 	if strings.HasPrefix(def, "rexexp:") {
+		fmt.Fprintf(os.Stderr, "warning: the matcher prefix 'rexexp:' is deprecated, use 'regexp:' instead\n")
+		def = "regexp:" + strings.TrimPrefix(def, "rexexp:")
+	}
+	if strings.HasPrefix(def, "regexp:") {
 		pattern := strings.TrimPrefix(def, "regexp:")
 		re, err := regexp.Compile(pattern)
 		if err != nil {
@@ -1,17 +1,23 @@
 package fetcher
 
 import (
+	"context"
 	"io"
 	"os"
-
-	"github.com/floj/logs2goaccess/filter"
+	"strings"
 )
 
-func fileResolver(loc string) ([]string, error) {
-	return []string{loc}, nil
+func fileResolver(ctx context.Context, loc string, o Options) ([]Location, error) {
+	l := Location{Name: loc, Size: -1}
+	// missing files are reported when they are opened
+	if fi, err := os.Stat(strings.TrimPrefix(loc, "file:")); err == nil {
+		l.Size = fi.Size()
+		l.LastModified = fi.ModTime()
+	}
+	return []Location{l}, nil
 }
 
-func fileReader(loc string, fc filter.FilterConf) (io.ReadCloser, error) {
+func fileReader(ctx context.Context, loc string, o Options) (io.ReadCloser, error) {
 	in, err := os.Open(loc)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,62 @@
+package fetcher
+
+import (
+	"regexp"
+	"time"
+)
+
+type keyDatePattern struct {
+	re     *regexp.Regexp
+	layout string
+	// span of logs a file with this name contains, relative to the parsed time
+	from, to time.Duration
+}
+
+// naming schemes of the log files written by AWS, the first match wins
+var keyDatePatterns = []keyDatePattern{
+	// ALB: ..._elasticloadbalancing_eu-central-1_app.my-lb.1234_20221018T1205Z_10.0.0.1_abcd.log.gz
+	// the time marks the end of the 5 minute interval
+	{re: regexp.MustCompile(`_(\d{8}T\d{4}Z)_`), layout: "20060102T1504Z", from: -5 * time.Minute, to: 0},
+	// CloudFront: E2ABCDEFGH.2022-10-18-12.abcd1234.gz
+	{re: regexp.MustCompile(`\.(\d{4}-\d{2}-\d{2}-\d{2})\.`), layout: "2006-01-02-15", from: 0, to: time.Hour},
+	// generic date partitioning like .../2022/10/18/...
+	{re: regexp.MustCompile(`(?:^|/)(\d{4}/\d{2}/\d{2})(?:/|$)`), layout: "2006/01/02", from: 0, to: 24 * time.Hour},
+}
+
+// files are not rotated exactly on time, allow for some late or early lines
+const keyDateSlack = time.Hour
+
+// inferKeyTimeRange guesses the time range of the logs contained in a file by its name
+func inferKeyTimeRange(key string) (from time.Time, to time.Time, ok bool) {
+	for _, p := range keyDatePatterns {
+		m := p.re.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+		t, err := time.Parse(p.layout, m[1])
+		if err != nil {
+			continue
+		}
+		return t.Add(p.from), t.Add(p.to), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// keyInTimeWindow reports whether a file might contain logs between after and before.
+// Files without a recognizable date are always included.
+func keyInTimeWindow(key string, after, before *time.Time) bool {
+	if after == nil && before == nil {
+		return true
+	}
+	from, to, ok := inferKeyTimeRange(key)
+	if !ok {
+		return true
+	}
+	if after != nil && to.Add(keyDateSlack).Before(*after) {
+		return false
+	}
+	if before != nil && from.Add(-keyDateSlack).After(*before) {
+		return false
+	}
+	return true
+}
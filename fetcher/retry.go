@@ -0,0 +1,69 @@
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// ErrorPolicy decides what happens if a location can not be read
+type ErrorPolicy string
+
+const (
+	// OnErrorFail aborts on the first error without retrying
+	OnErrorFail ErrorPolicy = "fail"
+	// OnErrorRetry retries and aborts if all attempts failed
+	OnErrorRetry ErrorPolicy = "retry"
+	// OnErrorSkip retries and skips the location if all attempts failed
+	OnErrorSkip ErrorPolicy = "skip"
+)
+
+func ParseErrorPolicy(v string) (ErrorPolicy, error) {
+	switch p := ErrorPolicy(v); p {
+	case OnErrorFail, OnErrorRetry, OnErrorSkip:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown error policy '%s', possible values are: fail, retry, skip", v)
+}
+
+// RetryPolicy configures the retries of failed requests. Delays grow exponentially from
+// BaseDelay up to MaxDelay, the actual delay is picked randomly up to that value.
+type RetryPolicy struct {
+	// Attempts is the total number of tries, values below 2 disable retries
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{Attempts: 5, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// do calls fn until it succeeds, the attempts are exhausted or ctx is done
+func (p RetryPolicy) do(ctx context.Context, what string, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || ctx.Err() != nil || attempt+1 >= p.Attempts {
+			return err
+		}
+		d := p.delay(attempt)
+		fmt.Fprintf(os.Stderr, "%s failed (attempt %d/%d), retrying in %s: %v\n", what, attempt+1, p.Attempts, d.Round(time.Millisecond), err)
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"sync"
 
@@ -16,11 +17,11 @@ import (
 var s3ClientOnce sync.Once
 var s3Client *s3.Client
 
-func getS3Client() (*s3.Client, error) {
+func getS3Client(ctx context.Context) (*s3.Client, error) {
 	var err error
 	s3ClientOnce.Do(func() {
 		var cfg aws.Config
-		cfg, err = config.LoadDefaultConfig(context.Background())
+		cfg, err = config.LoadDefaultConfig(ctx)
 		if err != nil {
 			return
 		}
@@ -29,15 +30,15 @@ func getS3Client() (*s3.Client, error) {
 	return s3Client, err
 }
 
-func s3LocationResolver(loc string) ([]string, error) {
+func s3LocationResolver(ctx context.Context, loc string, o Options) ([]Location, error) {
 	loc = strings.TrimPrefix(loc, "s3:")
 	if !strings.HasPrefix(loc, "recurse:") {
 		// remove '//' prefix if present as in s3://my-bucket
 		loc = strings.TrimPrefix(loc, "//")
-		return []string{loc}, nil
+		return []Location{{Name: "s3:" + loc, Size: -1}}, nil
 	}
 
-	client, err := getS3Client()
+	client, err := getS3Client(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +46,8 @@ func s3LocationResolver(loc string) ([]string, error) {
 	// remove '//' prefix if present as in s3:recurse://my-bucket
 	loc = strings.TrimPrefix(loc, "//")
 
-	locs := []string{}
+	locs := []Location{}
+	after, before := filter.TimeWindow(o.Predicate)
 
 	loc, matcher, err := findMatchers(loc)
 	if err != nil {
@@ -61,7 +63,12 @@ func s3LocationResolver(loc string) ([]string, error) {
 	})
 
 	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(context.Background())
+		var page *s3.ListObjectsV2Output
+		err := o.retry().do(ctx, "listing s3://"+loc, func() error {
+			var err error
+			page, err = paginator.NextPage(ctx)
+			return err
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -73,25 +80,96 @@ func s3LocationResolver(loc string) ([]string, error) {
 			if !matcher(*c.Key) {
 				continue
 			}
-			locs = append(locs, fmt.Sprintf("s3:%s/%s", bucket, *c.Key))
+			// skip objects which, according to their name, only contain logs outside of the time window
+			if !keyInTimeWindow(*c.Key, after, before) {
+				continue
+			}
+			l := Location{Name: fmt.Sprintf("s3:%s/%s", bucket, *c.Key), Size: c.Size}
+			if c.LastModified != nil {
+				l.LastModified = *c.LastModified
+			}
+			locs = append(locs, l)
 		}
 	}
 	return locs, nil
 }
 
-func s3Reader(loc string, fc filter.FilterConf) (io.ReadCloser, error) {
-	client, err := getS3Client()
+func s3Reader(ctx context.Context, loc string, o Options) (io.ReadCloser, error) {
+	client, err := getS3Client(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	parts := strings.Split(loc, "/")
-	resp, err := client.GetObject(context.Background(), &s3.GetObjectInput{
-		Bucket: &parts[0],
-		Key:    aws.String(strings.Join(parts[1:], "/")),
-	})
-	if err != nil {
+	r := &s3Body{
+		ctx:    ctx,
+		client: client,
+		bucket: parts[0],
+		key:    strings.Join(parts[1:], "/"),
+		retry:  o.retry(),
+	}
+	if err := r.get(); err != nil {
 		return nil, err
 	}
-	return wrapGzipIfRequired(resp.Body, loc)
+	return wrapGzipIfRequired(r, loc)
+}
+
+// s3Body reads an object and resumes at the current offset using a Range request if reading fails
+type s3Body struct {
+	ctx    context.Context
+	client *s3.Client
+	bucket string
+	key    string
+	retry  RetryPolicy
+
+	body   io.ReadCloser
+	etag   *string
+	offset int64
+	// resumes without any progress in between
+	failures int
+}
+
+func (r *s3Body) get() error {
+	what := fmt.Sprintf("fetching s3://%s/%s", r.bucket, r.key)
+	in := &s3.GetObjectInput{
+		Bucket: &r.bucket,
+		Key:    &r.key,
+	}
+	if r.offset > 0 {
+		what = fmt.Sprintf("%s from offset %d", what, r.offset)
+		in.Range = aws.String(fmt.Sprintf("bytes=%d-", r.offset))
+		// make sure the object did not change in between
+		in.IfMatch = r.etag
+	}
+	return r.retry.do(r.ctx, what, func() error {
+		resp, err := r.client.GetObject(r.ctx, in)
+		if err != nil {
+			return err
+		}
+		r.body = resp.Body
+		r.etag = resp.ETag
+		return nil
+	})
+}
+
+func (r *s3Body) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if n > 0 {
+		r.failures = 0
+	}
+	if err == nil || err == io.EOF || r.ctx.Err() != nil || r.failures+1 >= r.retry.Attempts {
+		return n, err
+	}
+	r.failures++
+	fmt.Fprintf(os.Stderr, "reading s3://%s/%s failed at offset %d, resuming: %v\n", r.bucket, r.key, r.offset, err)
+	r.body.Close()
+	if gerr := r.get(); gerr != nil {
+		return n, fmt.Errorf("%v, resuming failed: %w", err, gerr)
+	}
+	return n, nil
+}
+
+func (r *s3Body) Close() error {
+	return r.body.Close()
 }
@@ -1,7 +1,6 @@
 package filter
 
 import (
-	"strings"
 	"time"
 
 	"github.com/floj/logs2goaccess/goaccess"
@@ -14,95 +13,73 @@ type FilterConf struct {
 	ExcludeClientPrefix []string
 	ExcludeURLPrefix    []string
 	IncludeURLPrefix    []string
+	IncludeCountry      []string
+	ExcludeCountry      []string
+	IncludeASN          []string
+	ExcludeASN          []string
+	SampleRate          float64
+	SampleKey           string
 }
 
-func (c *FilterConf) Build() (Filter, error) {
-	filters := []Filter{}
-	filters = AddIfNotEmpty(filters, c.IncludeHostPrefix, NewIncludeHostsPrefixFilter)
-	filters = AddIfNotEmpty(filters, c.ExcludeClientPrefix, NewExcludeClientsPrefixFilter)
-	filters = AddIfNotEmpty(filters, c.ExcludeURLPrefix, NewExcludeURLsPrefixFilter)
-	filters = AddIfNotEmpty(filters, c.IncludeURLPrefix, NewIncludeURLsPrefixFilter)
+// Predicate describes the configured filters, all of its terms have to match
+func (c *FilterConf) Predicate() (Predicate, error) {
+	terms := All{}
+	terms = AddIfNotEmpty(terms, "include-vhost", c.IncludeHostPrefix, FieldVHost, false)
+	terms = AddIfNotEmpty(terms, "exclude-client-ip", c.ExcludeClientPrefix, FieldClientIP, true)
+	terms = AddIfNotEmpty(terms, "exclude-url", c.ExcludeURLPrefix, FieldURL, true)
+	terms = AddIfNotEmpty(terms, "include-url", c.IncludeURLPrefix, FieldURL, false)
+	terms = addInIfNotEmpty(terms, "include-country", c.IncludeCountry, FieldCountry, false)
+	terms = addInIfNotEmpty(terms, "exclude-country", c.ExcludeCountry, FieldCountry, true)
+	terms = addInIfNotEmpty(terms, "include-asn", c.IncludeASN, FieldASN, false)
+	terms = addInIfNotEmpty(terms, "exclude-asn", c.ExcludeASN, FieldASN, true)
 
-	if c.DateAfter != nil {
-		filters = append(filters, NewDateAfterFilter(*c.DateAfter))
-	}
-	if c.DateBefore != nil {
-		filters = append(filters, NewDateBeforeFilter(*c.DateBefore))
+	if c.DateAfter != nil || c.DateBefore != nil {
+		terms = append(terms, Rule{Name: "date-window", Term: TimeRange{After: c.DateAfter, Before: c.DateBefore}})
 	}
-	return func(l *goaccess.Line) bool {
-		for _, f := range filters {
-			if !f(l) {
-				return false
-			}
+	if c.SampleRate > 0 && c.SampleRate < 1 {
+		s, err := NewSample(c.SampleRate, c.SampleKey)
+		if err != nil {
+			return nil, err
 		}
-		return true
-	}, nil
-}
-
-type Filter func(*goaccess.Line) bool
-
-func AddIfNotEmpty(filters []Filter, v []string, fn func([]string) Filter) []Filter {
-	if len(v) == 0 {
-		return filters
+		terms = append(terms, Rule{Name: "sample", Term: s})
 	}
-	return append(filters, fn(v))
+	return terms, nil
 }
 
-func NewDateAfterFilter(d time.Time) Filter {
-	return func(l *goaccess.Line) bool {
-		return l.Timestamp.After(d)
-	}
-}
-func NewDateBeforeFilter(d time.Time) Filter {
-	return func(l *goaccess.Line) bool {
-		return l.Timestamp.Before(d)
+func (c *FilterConf) Build() (Filter, error) {
+	p, err := c.Predicate()
+	if err != nil {
+		return nil, err
 	}
+	return Compile(p), nil
 }
 
-func NewIncludeHostsPrefixFilter(prefixes []string) Filter {
-	return func(l *goaccess.Line) bool {
-		for _, p := range prefixes {
-			if strings.HasPrefix(l.VHost, p) {
-				return true
-			}
-		}
-		//fmt.Fprintf(os.Stderr, "excluding: VHost has no prefix in %v\n", prefixes)
-		return false
-	}
-}
+type Filter func(*goaccess.Line) bool
 
-func NewExcludeClientsPrefixFilter(prefixes []string) Filter {
-	return func(l *goaccess.Line) bool {
-		for _, p := range prefixes {
-			if strings.HasPrefix(l.ClientIP, p) {
-				//fmt.Fprintf(os.Stderr, "excluding: ClientIP has prefix %s\n", p)
-				return false
-			}
-		}
-		return true
+// AddIfNotEmpty adds a prefix rule on field to terms, if exclude is set the rule is negated
+func AddIfNotEmpty(terms All, name string, prefixes []string, field Field, exclude bool) All {
+	if len(prefixes) == 0 {
+		return terms
+	}
+	var p Predicate = HasPrefix{Field: field, Prefixes: prefixes}
+	if exclude {
+		p = Not{Term: p}
 	}
+	return append(terms, Rule{Name: name, Term: p})
 }
 
-func NewExcludeURLsPrefixFilter(prefixes []string) Filter {
-	return func(l *goaccess.Line) bool {
-		for _, p := range prefixes {
-			if strings.HasPrefix(l.URL, p) {
-				//fmt.Fprintf(os.Stderr, "excluding: URL has prefix %s\n", p)
-				return false
-			}
-		}
-		return true
+func addInIfNotEmpty(terms All, name string, values []string, field Field, exclude bool) All {
+	if len(values) == 0 {
+		return terms
+	}
+	var p Predicate = In{Field: field, Values: values}
+	if exclude {
+		p = Not{Term: p}
 	}
+	return append(terms, Rule{Name: name, Term: p})
 }
 
-func NewIncludeURLsPrefixFilter(prefixes []string) Filter {
-	return func(l *goaccess.Line) bool {
-		for _, p := range prefixes {
-			if strings.HasPrefix(l.URL, p) {
-				return true
-			}
-		}
-		//fmt.Fprintf(os.Stderr, "excluding: URL has no prefix in %v\n", prefixes)
-		return false
-	}
+// NeedsGeoIP reports whether any of the filters requires the lines to be enriched with geoip data
+func (c *FilterConf) NeedsGeoIP() bool {
+	return len(c.IncludeCountry)+len(c.ExcludeCountry)+len(c.IncludeASN)+len(c.ExcludeASN) > 0
 }
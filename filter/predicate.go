@@ -0,0 +1,327 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+// Field names a goaccess.Line field a predicate can look at, see goaccess.FieldNames
+type Field string
+
+const (
+	FieldVHost    Field = "vhost"
+	FieldClientIP Field = "client_ip"
+	FieldURL      Field = "url"
+	FieldCountry  Field = "country"
+	FieldASN      Field = "asn"
+)
+
+func (f Field) value(l *goaccess.Line) string {
+	v, _ := l.Get(string(f))
+	return v
+}
+
+// Predicate is an inspectable description of a filter. Fetchers can look at it to skip data
+// before it is parsed, Compile turns it into a Filter.
+type Predicate interface {
+	Match(l *goaccess.Line) bool
+	String() string
+}
+
+// All matches if all of its terms match, an empty All matches everything
+type All []Predicate
+
+func (p All) Match(l *goaccess.Line) bool {
+	for _, t := range p {
+		if !t.Match(l) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p All) String() string {
+	return join(p, " and ")
+}
+
+// Any matches if at least one of its terms matches
+type Any []Predicate
+
+func (p Any) Match(l *goaccess.Line) bool {
+	for _, t := range p {
+		if t.Match(l) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Any) String() string {
+	return join(p, " or ")
+}
+
+func join(pp []Predicate, sep string) string {
+	s := []string{}
+	for _, p := range pp {
+		s = append(s, p.String())
+	}
+	return "(" + strings.Join(s, sep) + ")"
+}
+
+// Not inverts Term
+type Not struct {
+	Term Predicate
+}
+
+func (p Not) Match(l *goaccess.Line) bool {
+	return !p.Term.Match(l)
+}
+
+func (p Not) String() string {
+	return "not " + p.Term.String()
+}
+
+// HasPrefix matches if Field starts with any of the Prefixes
+type HasPrefix struct {
+	Field    Field
+	Prefixes []string
+}
+
+func (p HasPrefix) Match(l *goaccess.Line) bool {
+	v := p.Field.value(l)
+	for _, pre := range p.Prefixes {
+		if strings.HasPrefix(v, pre) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p HasPrefix) String() string {
+	return fmt.Sprintf("%s has prefix %q", p.Field, p.Prefixes)
+}
+
+// In matches if Field equals any of the Values
+type In struct {
+	Field  Field
+	Values []string
+}
+
+func (p In) Match(l *goaccess.Line) bool {
+	v := p.Field.value(l)
+	for _, e := range p.Values {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
+
+func (p In) String() string {
+	return fmt.Sprintf("%s in %q", p.Field, p.Values)
+}
+
+// TimeRange matches lines with a timestamp after After and before Before, nil bounds are open
+type TimeRange struct {
+	After  *time.Time
+	Before *time.Time
+}
+
+func (p TimeRange) Match(l *goaccess.Line) bool {
+	if p.After != nil && !l.Timestamp.After(*p.After) {
+		return false
+	}
+	if p.Before != nil && !l.Timestamp.Before(*p.Before) {
+		return false
+	}
+	return true
+}
+
+func (p TimeRange) String() string {
+	f := func(t *time.Time) string {
+		if t == nil {
+			return "-"
+		}
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("timestamp in (%s, %s)", f(p.After), f(p.Before))
+}
+
+// Sample keeps a deterministic fraction of the lines. The decision is based on a hash of the
+// sample key, so all lines of a client (or request) are either kept or dropped together.
+type Sample struct {
+	Rate float64
+	Key  string
+}
+
+func (p Sample) Match(l *goaccess.Line) bool {
+	if p.Rate >= 1 {
+		return true
+	}
+	key, set := sampleKeys[p.Key]
+	if !set {
+		return false
+	}
+	return sampleHash(key(l)) < uint64(p.Rate*maxHash)
+}
+
+func (p Sample) String() string {
+	return fmt.Sprintf("sample %v by %s", p.Rate, p.Key)
+}
+
+// Rule gives Term a name used when reporting which rule rejected a line
+type Rule struct {
+	Name string
+	Term Predicate
+}
+
+func (p Rule) Match(l *goaccess.Line) bool {
+	return p.Term.Match(l)
+}
+
+func (p Rule) String() string {
+	return p.Name
+}
+
+// Compile turns p into a Filter
+func Compile(p Predicate) Filter {
+	return p.Match
+}
+
+// Conjuncts returns the terms which all have to match for p to match
+func Conjuncts(p Predicate) []Predicate {
+	switch t := p.(type) {
+	case Rule:
+		return Conjuncts(t.Term)
+	case All:
+		terms := []Predicate{}
+		for _, tt := range t {
+			terms = append(terms, Conjuncts(tt)...)
+		}
+		return terms
+	}
+	return []Predicate{p}
+}
+
+// RejectedBy returns the name of the first top level term of p not matching l.
+// If l matches p, an empty string is returned.
+func RejectedBy(p Predicate, l *goaccess.Line) string {
+	all, ok := p.(All)
+	if !ok {
+		all = All{p}
+	}
+	for _, t := range all {
+		if !t.Match(l) {
+			return t.String()
+		}
+	}
+	return ""
+}
+
+// TimeWindow returns the narrowest time range all lines matching p are in, nil bounds are open
+func TimeWindow(p Predicate) (after *time.Time, before *time.Time) {
+	for _, t := range Conjuncts(p) {
+		tr, ok := t.(TimeRange)
+		if !ok {
+			continue
+		}
+		if tr.After != nil && (after == nil || tr.After.After(*after)) {
+			after = tr.After
+		}
+		if tr.Before != nil && (before == nil || tr.Before.Before(*before)) {
+			before = tr.Before
+		}
+	}
+	return after, before
+}
+
+type substrings struct {
+	rule string
+	subs []string
+}
+
+// RequiredSubstrings returns groups of strings of which at least one per group has to be
+// contained in the raw log line for p to match. Only prefixes which show up verbatim in all
+// supported log formats are considered.
+func RequiredSubstrings(p Predicate) [][]string {
+	groups := [][]string{}
+	for _, g := range requiredSubstrings(p) {
+		groups = append(groups, g.subs)
+	}
+	return groups
+}
+
+func requiredSubstrings(p Predicate) []substrings {
+	all, ok := p.(All)
+	if !ok {
+		all = All{p}
+	}
+	groups := []substrings{}
+	for _, rule := range all {
+		for _, t := range Conjuncts(rule) {
+			hp, ok := t.(HasPrefix)
+			if !ok || hp.Field == FieldClientIP {
+				// client ips might be resolved from a forwarded header, don't rely on them
+				continue
+			}
+			if len(hp.Prefixes) == 0 {
+				continue
+			}
+			usable := true
+			for _, pre := range hp.Prefixes {
+				if !isVerbatim(pre) {
+					usable = false
+					break
+				}
+			}
+			if usable {
+				groups = append(groups, substrings{rule: rule.String(), subs: hp.Prefixes})
+			}
+		}
+	}
+	return groups
+}
+
+// isVerbatim reports whether s is non-empty and contains no characters that might be escaped in a log line
+func isVerbatim(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("./-_:~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RawLineFilter returns a cheap check on the unparsed line that rejects lines which can not
+// match p. The check returns the name of the rejecting rule or an empty string if the line might
+// match. If p has nothing to check on the raw line, nil is returned.
+func RawLineFilter(p Predicate) func(string) string {
+	groups := requiredSubstrings(p)
+	if len(groups) == 0 {
+		return nil
+	}
+	return func(s string) string {
+		for _, g := range groups {
+			found := false
+			for _, sub := range g.subs {
+				if strings.Contains(s, sub) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return g.rule
+			}
+		}
+		return ""
+	}
+}
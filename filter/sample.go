@@ -0,0 +1,82 @@
+package filter
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+var sampleKeys = map[string]func(*goaccess.Line) string{
+	"client-ip": func(l *goaccess.Line) string { return l.ClientIP },
+	"request-id": func(l *goaccess.Line) string {
+		// not every format carries a request id, keep those lines grouped by client instead
+		if l.RequestID == "" {
+			return l.ClientIP
+		}
+		return l.RequestID
+	},
+}
+
+// ParseSampleRate accepts either a fraction like '1/20' or a rate like '0.05'
+func ParseSampleRate(v string) (float64, error) {
+	var rate float64
+	if parts := strings.SplitN(v, "/", 2); len(parts) == 2 {
+		num, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid sample fraction: %w", v, err)
+		}
+		denom, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid sample fraction: %w", v, err)
+		}
+		if denom == 0 {
+			return 0, fmt.Errorf("'%s' is not a valid sample fraction: division by zero", v)
+		}
+		rate = num / denom
+	} else {
+		r, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not a valid sample rate: %w", v, err)
+		}
+		rate = r
+	}
+	if rate <= 0 || rate > 1 {
+		return 0, fmt.Errorf("sample rate must be in (0, 1], got %v", rate)
+	}
+	return rate, nil
+}
+
+const maxHash = float64(math.MaxUint64)
+
+// sampleHash hashes key evenly over the whole uint64 range
+func sampleHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return mix(h.Sum64())
+}
+
+// mix spreads the bits of short and similar keys (like IPs) over the whole range (splitmix64 finalizer)
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// NewSample validates the sample key and returns a Sample predicate
+func NewSample(rate float64, keyName string) (Predicate, error) {
+	if _, set := sampleKeys[keyName]; !set {
+		names := []string{}
+		for n := range sampleKeys {
+			names = append(names, n)
+		}
+		return nil, fmt.Errorf("unknown sample key '%s', known keys: %v", keyName, names)
+	}
+	return Sample{Rate: rate, Key: keyName}, nil
+}
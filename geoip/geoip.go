@@ -0,0 +1,110 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+// record covers the fields of the GeoLite2 and DB-IP country, city and ASN databases
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// Enricher looks up the ClientIP of a line in local .mmdb databases and sets Country, ASN and ASOrg
+type Enricher struct {
+	dbs []*maxminddb.Reader
+	// if set, the country is additionally written into this output field
+	countryField string
+	failed       int
+}
+
+var countryFields = map[string]func(*goaccess.Line, string){
+	"username": func(l *goaccess.Line, c string) { l.Username = c },
+}
+
+// Open opens the given databases, usually a country (or city) and an ASN database.
+// If countryField is not empty, the country is also written into the named output field.
+func Open(paths []string, countryField string) (*Enricher, error) {
+	if _, set := countryFields[countryField]; countryField != "" && !set {
+		names := []string{}
+		for n := range countryFields {
+			names = append(names, n)
+		}
+		return nil, fmt.Errorf("can not write the country into '%s', possible fields are: %v", countryField, names)
+	}
+	e := &Enricher{countryField: countryField}
+	for _, p := range paths {
+		db, err := maxminddb.Open(p)
+		if err != nil {
+			e.Close()
+			return nil, fmt.Errorf("could not open geoip database '%s': %w", p, err)
+		}
+		e.dbs = append(e.dbs, db)
+	}
+	return e, nil
+}
+
+func (e *Enricher) Close() error {
+	var firstErr error
+	for _, db := range e.dbs {
+		if err := db.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Enrich is a normalizer.Normalizer, lines with an unparsable or unknown ClientIP are left untouched.
+// Failed lookups are counted, see Failed, the line is kept with the fields of that database empty.
+func (e *Enricher) Enrich(l *goaccess.Line) (*goaccess.Line, error) {
+	ip := net.ParseIP(l.ClientIP)
+	if ip == nil {
+		return l, nil
+	}
+	for _, db := range e.dbs {
+		r := record{}
+		if err := db.Lookup(ip, &r); err != nil {
+			e.failed++
+			continue
+		}
+		if r.Country.ISOCode != "" {
+			l.Country = r.Country.ISOCode
+		}
+		if r.ASN != 0 {
+			l.ASN = r.ASN
+		}
+		if r.ASOrg != "" {
+			l.ASOrg = r.ASOrg
+		}
+	}
+	if e.countryField != "" {
+		countryFields[e.countryField](l, l.Country)
+	}
+	return l, nil
+}
+
+// Failed returns the number of lookups which failed
+func (e *Enricher) Failed() int {
+	return e.failed
+}
+
+// ParseASN accepts AS numbers with and without the 'AS' prefix
+func ParseASN(v string) (uint, error) {
+	if len(v) > 2 && (v[:2] == "AS" || v[:2] == "as") {
+		v = v[2:]
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a valid AS number", v)
+	}
+	return uint(n), nil
+}
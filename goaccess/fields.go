@@ -0,0 +1,98 @@
+package goaccess
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+type fieldAccessor struct {
+	get func(l *Line) string
+	set func(l *Line, v string) error
+}
+
+func stringField(f func(l *Line) *string) fieldAccessor {
+	return fieldAccessor{
+		get: func(l *Line) string { return *f(l) },
+		set: func(l *Line, v string) error { *f(l) = v; return nil },
+	}
+}
+
+// fields are the fields of a Line which can be accessed by name, e.g. by filters and rewrite rules
+var fields = map[string]fieldAccessor{
+	"vhost":         stringField(func(l *Line) *string { return &l.VHost }),
+	"username":      stringField(func(l *Line) *string { return &l.Username }),
+	"client_ip":     stringField(func(l *Line) *string { return &l.ClientIP }),
+	"method":        stringField(func(l *Line) *string { return &l.Method }),
+	"path":          stringField(func(l *Line) *string { return &l.URL }),
+	"query":         stringField(func(l *Line) *string { return &l.Query }),
+	"protocol":      stringField(func(l *Line) *string { return &l.Protocol }),
+	"referer":       stringField(func(l *Line) *string { return &l.Referer }),
+	"user_agent":    stringField(func(l *Line) *string { return &l.UserAgent }),
+	"tls_protocol":  stringField(func(l *Line) *string { return &l.TLSProtocol }),
+	"tls_cipher":    stringField(func(l *Line) *string { return &l.TLSCipher }),
+	"content_type":  stringField(func(l *Line) *string { return &l.ContentType }),
+	"cache_status":  stringField(func(l *Line) *string { return &l.CacheStatus }),
+	"forwarded_for": stringField(func(l *Line) *string { return &l.ForwardedFor }),
+	"request_id":    stringField(func(l *Line) *string { return &l.RequestID }),
+	"country":       stringField(func(l *Line) *string { return &l.Country }),
+	"as_org":        stringField(func(l *Line) *string { return &l.ASOrg }),
+	// url is the path including the query string
+	"url": {
+		get: func(l *Line) string { return l.RequestURI() },
+		set: func(l *Line, v string) error { l.SetRequestURI(v); return nil },
+	},
+	"status": {
+		get: func(l *Line) string { return strconv.Itoa(l.ResponseStatus) },
+		set: func(l *Line, v string) (err error) { l.ResponseStatus, err = strconv.Atoi(v); return },
+	},
+	"bytes": {
+		get: func(l *Line) string { return strconv.FormatInt(l.ResponseSize, 10) },
+		set: func(l *Line, v string) (err error) { l.ResponseSize, err = strconv.ParseInt(v, 10, 64); return },
+	},
+	"asn": {
+		get: func(l *Line) string { return strconv.FormatUint(uint64(l.ASN), 10) },
+		set: func(l *Line, v string) error {
+			n, err := strconv.ParseUint(v, 10, 32)
+			l.ASN = uint(n)
+			return err
+		},
+	},
+}
+
+// FieldNames returns the names of all fields accessible by Get and Set
+func FieldNames() []string {
+	names := []string{}
+	for n := range fields {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsField reports whether name is a field accessible by Get and Set
+func IsField(name string) bool {
+	_, set := fields[name]
+	return set
+}
+
+// Get returns the value of the named field
+func (l *Line) Get(name string) (string, error) {
+	f, set := fields[name]
+	if !set {
+		return "", fmt.Errorf("unknown field '%s', known fields: %v", name, FieldNames())
+	}
+	return f.get(l), nil
+}
+
+// Set parses v and sets the named field
+func (l *Line) Set(name string, v string) error {
+	f, set := fields[name]
+	if !set {
+		return fmt.Errorf("unknown field '%s', known fields: %v", name, FieldNames())
+	}
+	if err := f.set(l, v); err != nil {
+		return fmt.Errorf("'%s' is not a valid value for %s: %w", v, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package goaccess
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// outputField is a column of the tab separated format
+type outputField struct {
+	name      string
+	specifier string
+	value     func(l *Line) string
+	// panels of goaccess which are empty without the field
+	panels []string
+}
+
+var outputFields = []outputField{
+	{"date", "%d", func(l *Line) string { return l.Timestamp.Format(localDate) }, []string{"VISITORS"}},
+	{"time", "%t", func(l *Line) string { return l.Timestamp.Format(localTime) }, []string{"VISIT_TIMES"}},
+	{"vhost", "%v", func(l *Line) string { return l.VHost }, []string{"VIRTUAL_HOSTS"}},
+	{"user", "%e", func(l *Line) string { return l.Username }, []string{"REMOTE_USER"}},
+	{"host", "%h", func(l *Line) string { return l.ClientIP }, []string{"HOSTS", "GEO_LOCATION", "ASN"}},
+	// goaccess picks the client from the chain, the client ip is written if there is none
+	{"xff", "~h{, }", func(l *Line) string {
+		if l.ForwardedFor == "" {
+			return l.ClientIP
+		}
+		return l.ForwardedFor
+	}, []string{"HOSTS", "GEO_LOCATION", "ASN"}},
+	{"method", "%m", func(l *Line) string { return l.Method }, nil},
+	{"url", "%U", func(l *Line) string { return l.URL }, []string{"REQUESTS", "REQUESTS_STATIC", "NOT_FOUND"}},
+	{"query", "%q", func(l *Line) string { return l.Query }, nil},
+	{"protocol", "%H", func(l *Line) string { return l.Protocol }, nil},
+	{"status", "%s", func(l *Line) string { return strconv.Itoa(l.ResponseStatus) }, []string{"STATUS_CODES", "NOT_FOUND"}},
+	{"bytes", "%b", func(l *Line) string { return strconv.FormatInt(l.ResponseSize, 10) }, nil},
+	{"referer", "%R", func(l *Line) string { return l.Referer }, []string{"REFERRERS", "REFERRING_SITES", "KEYPHRASES"}},
+	{"ua", "%u", func(l *Line) string { return l.UserAgent }, []string{"OS", "BROWSERS"}},
+	{"tls_protocol", "%K", func(l *Line) string { return l.TLSProtocol }, []string{"TLS_TYPE"}},
+	{"tls_cipher", "%k", func(l *Line) string { return l.TLSCipher }, nil},
+	{"content_type", "%M", func(l *Line) string { return l.ContentType }, []string{"MIME_TYPE"}},
+	{"cache_status", "%C", func(l *Line) string { return orDash(l.CacheStatus) }, []string{"CACHE_STATUS"}},
+	{"latency_us", "%D", func(l *Line) string { return strconv.FormatInt(l.RequestDuration.Microseconds(), 10) }, nil},
+	{"latency_ms", "%L", func(l *Line) string { return strconv.FormatInt(l.RequestDuration.Milliseconds(), 10) }, nil},
+	{"latency_s", "%T", func(l *Line) string { return strconv.FormatFloat(l.RequestDuration.Seconds(), 'f', 3, 64) }, nil},
+}
+
+// Layout are the columns written to the tab separated format
+type Layout []outputField
+
+// DefaultLayout is used by LineFormat and ToGoAccess
+var DefaultLayout = mustParseLayout(DefaultLayoutFields)
+
+// DefaultLayoutFields are the names of the fields of DefaultLayout. They match the log-format of
+// earlier versions, so existing goaccess configs keep working. Further fields have to be chosen.
+var DefaultLayoutFields = []string{
+	"date", "time", "vhost", "user", "host", "method", "url", "status", "bytes",
+	"referer", "ua", "tls_protocol", "tls_cipher", "content_type", "latency_ms",
+}
+
+// LayoutFields returns the names of all fields which can be used in a Layout
+func LayoutFields() []string {
+	names := []string{}
+	for _, f := range outputFields {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// ParseLayout returns the layout with the named fields in the given order
+func ParseLayout(names []string) (Layout, error) {
+	ly := Layout{}
+	seen := map[string]bool{}
+	for _, n := range names {
+		f, found := findOutputField(strings.TrimSpace(n))
+		if !found {
+			return nil, fmt.Errorf("unknown output field '%s', known fields: %v", n, LayoutFields())
+		}
+		if seen[f.specifier] {
+			return nil, fmt.Errorf("output field '%s' is given more than once", n)
+		}
+		seen[f.specifier] = true
+		ly = append(ly, f)
+	}
+	if !seen["%d"] || !seen["%t"] {
+		return nil, fmt.Errorf("the output fields have to contain date and time")
+	}
+	if !seen["%h"] && !seen["~h{, }"] {
+		return nil, fmt.Errorf("the output fields have to contain host or xff")
+	}
+	// without a query column the query string stays part of the url, as in earlier versions
+	if !seen["%q"] {
+		for i := range ly {
+			if ly[i].specifier == "%U" {
+				ly[i].value = func(l *Line) string { return l.RequestURI() }
+			}
+		}
+	}
+	return ly, nil
+}
+
+func mustParseLayout(names []string) Layout {
+	ly, err := ParseLayout(names)
+	if err != nil {
+		panic(err)
+	}
+	return ly
+}
+
+func findOutputField(name string) (outputField, bool) {
+	for _, f := range outputFields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return outputField{}, false
+}
+
+// LineFormat returns the log-format to use in goaccess
+func (ly Layout) LineFormat() string {
+	specs := []string{}
+	for _, f := range ly {
+		specs = append(specs, f.specifier)
+	}
+	return strings.Join(specs, `\t`)
+}
+
+// Format formats the line, all fields are escaped (see Escape). It additionally reports whether
+// any field had to be escaped.
+func (ly Layout) Format(l *Line) (string, bool) {
+	b := strings.Builder{}
+	escaped := false
+	for i, f := range ly {
+		if i > 0 {
+			b.WriteByte('\t')
+		}
+		v := f.value(l)
+		if needsEscape(v) {
+			v = Escape(v)
+			escaped = true
+		}
+		b.WriteString(v)
+	}
+	return b.String(), escaped
+}
+
+// WriteConfig writes a goaccess config file matching the layout. Panels which would stay empty
+// because their fields are not written are disabled.
+func (ly Layout) WriteConfig(w io.Writer) error {
+	written := map[string]bool{}
+	for _, f := range ly {
+		for _, p := range f.panels {
+			written[p] = true
+		}
+	}
+	ignored := []string{}
+	for _, f := range outputFields {
+		for _, p := range f.panels {
+			if !written[p] {
+				ignored = append(ignored, p)
+				written[p] = true
+			}
+		}
+	}
+
+	lines := []string{
+		"# generated by logs2goaccess, the log-format has to match its --out-fields",
+		"log-format " + ly.LineFormat(),
+		"date-format " + DateFormat,
+		"time-format " + TimeFormat,
+	}
+	for _, p := range ignored {
+		lines = append(lines, "ignore-panel "+p)
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
@@ -1,7 +1,6 @@
 package goaccess
 
 import (
-	"strconv"
 	"strings"
 	"time"
 )
@@ -40,7 +39,9 @@ type Line struct {
 	Username        string        // %e
 	ClientIP        string        // %h
 	Method          string        // %m
-	URL             string        // %U
+	URL             string        // %U path only, see RequestURI
+	Query           string        // %q without the leading ?
+	Protocol        string        // %H
 	ResponseStatus  int           // %s
 	ResponseSize    int64         // %b
 	Referer         string        // %R
@@ -48,7 +49,20 @@ type Line struct {
 	TLSProtocol     string        // %K
 	TLSCipher       string        // %k
 	ContentType     string        // %M
+	CacheStatus     string        // %C one of the values goaccess knows, e.g. HIT, MISS
 	RequestDuration time.Duration // %L
+
+	// not written by default, used for sampling, filtering and the structured formats
+	ForwardedFor string // ~h the X-Forwarded-For chain
+	RequestID    string
+	Country      string // ISO country code of the ClientIP
+	ASN          uint   // autonomous system number of the ClientIP
+	ASOrg        string // organization of the autonomous system
+	// location the line was read from and its line number starting at 1
+	Source     string
+	SourceLine int
+	// the fields of the original log line, only set if the transformer is asked to keep them
+	SourceFields map[string]string
 }
 
 const (
@@ -59,44 +73,39 @@ const (
 	localTime = "15:04:05"
 )
 
+// LineFormat returns the log-format of DefaultLayout
 func LineFormat() string {
-	fields := []string{
-		"%d",
-		"%t",
-		"%v",
-		"%e",
-		"%h",
-		"%m",
-		"%U",
-		"%s",
-		"%b",
-		"%R",
-		"%u",
-		"%K",
-		"%k",
-		"%M",
-		"%L",
-	}
-	return strings.Join(fields, `\t`)
+	return DefaultLayout.LineFormat()
 }
 
+// ToGoAccess formats the line as described by LineFormat, all fields are escaped (see Escape)
 func (l *Line) ToGoAccess() string {
-	fields := []string{
-		/* %d */ l.Timestamp.Format(localDate),
-		/* %t */ l.Timestamp.Format(localTime),
-		/* %v */ l.VHost,
-		/* %e */ l.Username,
-		/* %h */ l.ClientIP,
-		/* %m */ l.Method,
-		/* %U */ l.URL,
-		/* %s */ strconv.Itoa(l.ResponseStatus),
-		/* %b */ strconv.FormatInt(l.ResponseSize, 10),
-		/* %R */ l.Referer,
-		/* %u */ l.UserAgent,
-		/* %K */ l.TLSProtocol,
-		/* %k */ l.TLSCipher,
-		/* %M */ l.ContentType,
-		/* %L */ strconv.FormatInt(l.RequestDuration.Milliseconds(), 10),
+	s, _ := l.FormatGoAccess()
+	return s
+}
+
+// FormatGoAccess is like ToGoAccess, it additionally reports whether any field had to be escaped
+func (l *Line) FormatGoAccess() (string, bool) {
+	return DefaultLayout.Format(l)
+}
+
+// orDash returns "-" for empty values, goaccess ignores unknown values but rejects empty ones for some fields
+func orDash(s string) string {
+	if s == "" {
+		return "-"
 	}
-	return strings.Join(fields, "\t")
+	return s
+}
+
+// RequestURI returns the path and the query string
+func (l *Line) RequestURI() string {
+	if l.Query == "" {
+		return l.URL
+	}
+	return l.URL + "?" + l.Query
+}
+
+// SetRequestURI splits uri into the path and the query string
+func (l *Line) SetRequestURI(uri string) {
+	l.URL, l.Query, _ = strings.Cut(uri, "?")
 }
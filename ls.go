@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/floj/logs2goaccess/fetcher"
+)
+
+// listLocations prints the resolved locations with their metadata without reading them
+func listLocations(ctx context.Context, w io.Writer, locations []string, o fetcher.Options) error {
+	locs, err := fetcher.Resolve(ctx, locations, o)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	unknownSizes := 0
+	var first, last time.Time
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "location\tsize\tlast modified\tlogs from\tlogs to")
+	for _, l := range locs {
+		size := "-"
+		if l.Size >= 0 {
+			size = fmt.Sprint(l.Size)
+			total += l.Size
+		} else {
+			unknownSizes++
+		}
+		modified := "-"
+		if !l.LastModified.IsZero() {
+			modified = l.LastModified.UTC().Format(time.RFC3339)
+		}
+		from, to := "-", "-"
+		if f, t, ok := l.TimeRange(); ok {
+			from, to = f.Format(time.RFC3339), t.Format(time.RFC3339)
+			if first.IsZero() || f.Before(first) {
+				first = f
+			}
+			if t.After(last) {
+				last = t
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", l.Name, size, modified, from, to)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d locations, %d bytes", len(locs), total)
+	if unknownSizes > 0 {
+		fmt.Fprintf(w, " (%d of unknown size)", unknownSizes)
+	}
+	if !first.IsZero() {
+		fmt.Fprintf(w, ", logs from %s to %s", first.Format(time.RFC3339), last.Format(time.RFC3339))
+	}
+	fmt.Fprintln(w)
+	return nil
+}
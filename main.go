@@ -1,40 +1,155 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	flag "github.com/spf13/pflag"
 
 	"github.com/floj/logs2goaccess/fetcher"
 	"github.com/floj/logs2goaccess/filter"
+	"github.com/floj/logs2goaccess/geoip"
 	"github.com/floj/logs2goaccess/goaccess"
+	"github.com/floj/logs2goaccess/metrics"
 	"github.com/floj/logs2goaccess/normalizer"
+	"github.com/floj/logs2goaccess/pipeline"
+	"github.com/floj/logs2goaccess/report"
+	"github.com/floj/logs2goaccess/sink"
 	"github.com/floj/logs2goaccess/transformer"
+	"github.com/floj/logs2goaccess/transformer/clientip"
 )
 
 func main() {
+	// subcommands are given as the first argument, flags apply to all of them
+	cmd := ""
+	if len(os.Args) > 1 && (os.Args[1] == "ls" || os.Args[1] == "report" || os.Args[1] == "serve-metrics") {
+		cmd = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	printLogFormat := flag.Bool("print-log-format", false, "Print the log-format to use in goaccess")
 	printDateFormat := flag.Bool("print-date-format", false, "Print the date-format to use in goaccess")
 	printTimeFormat := flag.Bool("print-time-format", false, "Print the time-format to use in goaccess")
+	writeGoAccessConf := flag.String("write-goaccess-conf", "", "write a goaccess config file with the log-format, date-format, time-format and panels matching --out-fields to this file")
+
+	configPath := flag.String("config", "", "YAML or TOML config file with defaults and named profiles, flags given on the command line take precedence")
+	profile := flag.String("profile", "", "name of the profile in the config file to use")
+	dryRun := flag.Bool("dry-run", false, "only list the locations which would be read with their size and date range, same as the ls command")
+	execGoAccess := flag.Bool("exec-goaccess", false, "start goaccess with the matching formats and pipe the output into it, arguments after -- are passed to goaccess, e.g. -- -o report.html")
+	execGoAccessBin := flag.String("exec-goaccess-bin", "goaccess", "goaccess executable to start with --exec-goaccess")
+	execGoAccessInterval := flag.Duration("exec-goaccess-interval", 0, "instead of streaming, write the output to --output (or a temporary file) and rerun goaccess on it in this interval and once at the end, e.g. to keep an HTML report up to date")
+	output := flag.String("output", "", "file to write the output to instead of stdout")
+	onSourceError := flag.String("on-source-error", string(fetcher.OnErrorRetry), "what to do if a location can not be read, possible values are: fail, retry (and fail if all retries failed), skip (after retrying)")
+	sourceRetries := flag.Int("source-retries", fetcher.DefaultRetryPolicy.Attempts, "number of attempts to read a location or to send a request before giving up")
+	sourceRetryDelay := flag.Duration("source-retry-delay", fetcher.DefaultRetryPolicy.BaseDelay, "initial delay between retries, it doubles with every retry")
+	sourceRetryMaxDelay := flag.Duration("source-retry-max-delay", fetcher.DefaultRetryPolicy.MaxDelay, "maximum delay between retries")
+	stateFile := flag.String("state-file", "", "save the progress to this file when the run is interrupted or fails and resume from it on the next run, the output file is appended to when resuming")
 
+	outFmt := flag.String("out-format", "goaccess", "format of the output, possible values are: goaccess, json, csv, combined, sqlite (requires --output), parquet")
+	outAppend := flag.Bool("out-append", false, "append to --output instead of replacing it, lines of a location already in a sqlite database are skipped")
+	parquetCompression := flag.String("parquet-compression", "snappy", fmt.Sprintf("compression of --out-format parquet, possible values are: %s", strings.Join(sink.ParquetCompressions(), ", ")))
+	parquetRowGroupRows := flag.Int64("parquet-row-group-rows", 250000, "maximum number of rows per row group of --out-format parquet, a row group is buffered in memory")
+	parquetHivePartition := flag.Bool("parquet-hive-partition", false, "partition --out-format parquet by date, --output is the directory the files are written to as date=YYYY-MM-DD/part-*.parquet")
+	keepSourceFields := flag.Bool("keep-source-fields", false, "keep the fields of the original log lines, written as the source_fields column of --out-format parquet, can not be used with --anonymize-ip and --anonymize-user")
+	outSplitBy := flag.StringSlice("out-split-by", []string{}, "write the output into separate files by vhost, day, hour or status-class, --output is the path template, e.g. out/{vhost}/{date}.log.gz, placeholders are {vhost}, {date}, {hour}, {status_class}")
+	outMaxOpen := flag.Int("out-max-open", 64, "maximum number of files kept open with --out-split-by")
+	outFields := flag.StringSlice("out-fields", goaccess.DefaultLayoutFields, fmt.Sprintf("columns written by --out-format goaccess, possible values are: %s", strings.Join(goaccess.LayoutFields(), ", ")))
+	validateOutput := flag.Bool("validate-output", false, "report lines with fields that had to be escaped for the goaccess format (tabs, newlines, control characters) and count them in the summary")
 	inFmt := flag.String("in-format", "", "format of the data read, possible values are: caddy, aws-elb, aws-cloudfront")
 
 	filterIncludeVHosts := flag.StringSlice("filter-include-vhost", []string{}, "only include logs matching the vhost prefix")
 	filterExcludeClientIPs := flag.StringSlice("filter-exclude-client-ip", []string{}, "exclude logs matching the client ip prefix")
 	filterExcludeURLs := flag.StringSlice("filter-exclude-url", []string{}, "exclude logs matching the URL prefix")
 	filterIncludeURLs := flag.StringSlice("filter-include-url", []string{}, "include logs matching the URL prefix")
+	filterIncludeCountries := flag.StringSlice("filter-include-country", []string{}, "only include logs from clients in these countries (ISO codes), requires --geoip-db")
+	filterExcludeCountries := flag.StringSlice("filter-exclude-country", []string{}, "exclude logs from clients in these countries (ISO codes), requires --geoip-db")
+	filterIncludeASNs := flag.StringSlice("filter-include-asn", []string{}, "only include logs from clients in these autonomous systems, requires --geoip-db")
+	filterExcludeASNs := flag.StringSlice("filter-exclude-asn", []string{}, "exclude logs from clients in these autonomous systems, requires --geoip-db")
 	//filterDateBefore := flag.TStringSlice("filter-date-before", []string{}, "exclude logs matching the URL prefix")
 	filterDateAfter := flag.String("filter-date-from", "", "only include logs after at this date")
 	filterDateBefore := flag.String("filter-date-to", "", "only include logs before this date")
 	normalizeURLs := flag.StringSlice("normalize-url", []string{}, "perform some normalisation on the url")
+	queryDropAll := flag.Bool("query-drop-all", false, "remove the query string from the url")
+	queryKeep := flag.StringSlice("query-keep", []string{}, "only keep these query parameters, supports glob patterns")
+	queryDrop := flag.StringSlice("query-drop", []string{}, "remove these query parameters, supports glob patterns, e.g. utm_*,fbclid")
+	querySort := flag.Bool("query-sort", false, "sort query parameters by key")
+	queryRedact := flag.StringSlice("query-redact", []string{}, "replace the values of these query parameters, supports glob patterns, e.g. token,password,X-Amz-Signature")
+	rewriteRules := flag.StringSlice("rewrite-rules", []string{}, "YAML file(s) with rules to rewrite or drop lines based on any field")
+	templatePaths := flag.Bool("template-paths", false, "replace ids, uuids, hashes, tokens and dates in the url path by placeholders like {id}")
+	templateRoutes := flag.String("template-routes", "", "file with route patterns like /users/{id} or an OpenAPI spec, matching paths are replaced by the route, implies --template-paths")
+	refererMode := flag.String("referer-mode", "", "reduce the referer, possible values are: origin, host-path, strip-query")
+	refererPunycode := flag.Bool("referer-decode-punycode", false, "decode punycode hosts in the referer")
+	refererDropInternal := flag.Bool("referer-drop-internal", false, "remove referers pointing to the vhost of the request")
+	refererOwnDomains := flag.StringSlice("referer-own-domain", []string{}, "remove referers pointing to these domains and their subdomains")
+	anonymizeIP := flag.String("anonymize-ip", "", "anonymize the client ip, possible values are: truncate, pseudonymize")
+	anonymizeIPv4Bits := flag.Int("anonymize-ipv4-bits", 24, "number of leading bits of IPv4 addresses kept by --anonymize-ip truncate")
+	anonymizeIPv6Bits := flag.Int("anonymize-ipv6-bits", 48, "number of leading bits of IPv6 addresses kept by --anonymize-ip truncate")
+	anonymizeRotation := flag.Duration("anonymize-rotation", 24*time.Hour, "pseudonyms stay stable within this window of request time, 0 never rotates")
+	anonymizeKeyFile := flag.String("anonymize-key-file", "", "file containing the secret key used to pseudonymize client ips and hash usernames")
+	anonymizeUser := flag.String("anonymize-user", "", "anonymize the user portion of the username, possible values are: strip, hash")
+	sample := flag.String("sample", "", "only include a deterministic sample of the logs, e.g. 1/20")
+	sampleRate := flag.Float64("sample-rate", 0, "only include a deterministic sample of the logs, e.g. 0.05")
+	sampleBy := flag.String("sample-by", "client-ip", "key to sample on, possible values are: client-ip (all lines of a client are kept or skipped together), request-id (every request is sampled on its own)")
+	sampleScale := flag.Bool("sample-scale", false, "scale the counts in the summary back up by the sample rate")
+	trustedProxies := flag.StringSlice("trusted-proxy", []string{}, "CIDRs or ips of proxies whose forwarding headers are trusted to resolve the client ip. Without it the TCP peer is the client, so logs of servers behind a load balancer or CDN need it to report the real clients. Note: caddy logs used the last X-Forwarded-For entry before, set the proxies here to keep getting the clients behind them")
+	clientIPHeaders := flag.StringSlice("client-ip-header", clientip.DefaultHeaders, "headers to resolve the client ip from if the request came from a trusted proxy, e.g. X-Forwarded-For, Forwarded, X-Real-IP, CF-Connecting-IP")
+	geoipDBs := flag.StringSlice("geoip-db", []string{}, "GeoLite2 or DB-IP .mmdb database(s) to look up the client ip in, usually a country and an ASN database")
+	geoipCountryField := flag.String("geoip-country-field", "", "additionally write the country of the client into this output field, replacing its value, possible values are: username. Can not be used with --anonymize-user")
+	reportFormat := flag.String("report-format", "table", fmt.Sprintf("format of the report command, possible values are: %s", strings.Join(report.Formats(), ", ")))
+	reportTop := flag.Int("report-top", 10, "number of entries per table of the report command")
+	reportMaxKeys := flag.Int("report-max-keys", 100000, "maximum number of distinct keys per table the report command keeps in memory, further keys are counted as "+report.Other)
+	metricsListen := flag.String("metrics-listen", ":9180", "address the serve-metrics command serves /metrics on")
+	metricsLabels := flag.StringSlice("metrics-labels", metrics.DefaultLabels, fmt.Sprintf("labels of the request metrics of the serve-metrics command, possible values are: %s. Only use url with normalized urls, e.g. --template-paths", strings.Join(metrics.Labels(), ", ")))
+	metricsMaxSeries := flag.Int("metrics-max-series", 1000, "maximum number of label combinations of the serve-metrics command, further requests are counted with all labels set to "+metrics.Overflow)
+	metricsBuckets := flag.Float64Slice("metrics-buckets", []float64{}, "latency histogram buckets in seconds of the serve-metrics command, defaults to the prometheus default buckets")
+	summaryFormat := flag.String("summary-format", "text", "format of the summary printed to stderr at the end, possible values are: text, json")
 
 	flag.Parse()
 
+	configLocations := []string{}
+	if *configPath != "" {
+		locs, err := applyConfig(flag.CommandLine, *configPath, *profile)
+		if err != nil {
+			fmt.Println("flag --config:", err)
+			os.Exit(1)
+		}
+		configLocations = locs
+	} else if *profile != "" {
+		fmt.Println("flag --profile requires --config")
+		os.Exit(1)
+	}
+
+	// split after applying the config, --exec-goaccess may be set there
+	locations := flag.Args()
+	goaccessExtraArgs := []string{}
+	if dash := flag.CommandLine.ArgsLenAtDash(); *execGoAccess && dash >= 0 {
+		locations, goaccessExtraArgs = flag.Args()[:dash], flag.Args()[dash:]
+	}
+	if len(locations) == 0 {
+		locations = configLocations
+	}
+
+	layout, err := goaccess.ParseLayout(*outFields)
+	if err != nil {
+		fmt.Println("flag --out-fields:", err)
+		os.Exit(1)
+	}
+
 	if *printLogFormat {
-		fmt.Println(goaccess.LineFormat())
+		fmt.Println(layout.LineFormat())
 		return
 	}
 	if *printDateFormat {
@@ -45,16 +160,43 @@ func main() {
 		fmt.Println(goaccess.TimeFormat)
 		return
 	}
+	if *writeGoAccessConf != "" {
+		f, err := os.Create(*writeGoAccessConf)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		if err := layout.WriteConfig(f); err != nil {
+			panic(err)
+		}
+		return
+	}
 
 	filterConf := filter.FilterConf{
 		IncludeHostPrefix:   *filterIncludeVHosts,
 		ExcludeClientPrefix: *filterExcludeClientIPs,
 		ExcludeURLPrefix:    *filterExcludeURLs,
 		IncludeURLPrefix:    *filterIncludeURLs,
+		IncludeCountry:      upper(*filterIncludeCountries),
+		ExcludeCountry:      upper(*filterExcludeCountries),
+		SampleRate:          *sampleRate,
+		SampleKey:           *sampleBy,
+	}
+
+	if *dryRun {
+		cmd = "ls"
 	}
 
 	flagErrs := []string{}
-	if *inFmt == "" {
+	if *parquetHivePartition {
+		if *outFmt != "parquet" || *output == "" || len(*outSplitBy) > 0 {
+			flagErrs = append(flagErrs, "--parquet-hive-partition requires --out-format parquet and --output, and can not be used with --out-split-by")
+		} else {
+			*outSplitBy = []string{"day"}
+			*output = filepath.Join(*output, "date={date}", "part-{part}.parquet")
+		}
+	}
+	if *inFmt == "" && cmd != "ls" {
 		flagErrs = append(flagErrs, "--in-format is required")
 	}
 
@@ -72,6 +214,107 @@ func main() {
 		}
 		filterConf.DateBefore = d
 	}
+	if *sample != "" {
+		if *sampleRate != 0 {
+			flagErrs = append(flagErrs, "--sample and --sample-rate are mutually exclusive")
+		}
+		r, err := filter.ParseSampleRate(*sample)
+		if err != nil {
+			flagErrs = append(flagErrs, fmt.Sprintf("--sample: %v", err))
+		}
+		filterConf.SampleRate = r
+	} else if *sampleRate < 0 || *sampleRate > 1 {
+		flagErrs = append(flagErrs, "--sample-rate must be in (0, 1]")
+	}
+
+	for _, asns := range []struct {
+		flag string
+		in   []string
+		out  *[]string
+	}{
+		{"--filter-include-asn", *filterIncludeASNs, &filterConf.IncludeASN},
+		{"--filter-exclude-asn", *filterExcludeASNs, &filterConf.ExcludeASN},
+	} {
+		for _, v := range asns.in {
+			n, err := geoip.ParseASN(v)
+			if err != nil {
+				flagErrs = append(flagErrs, fmt.Sprintf("%s: %v", asns.flag, err))
+				continue
+			}
+			*asns.out = append(*asns.out, strconv.FormatUint(uint64(n), 10))
+		}
+	}
+	if (filterConf.NeedsGeoIP() || *geoipCountryField != "") && len(*geoipDBs) == 0 {
+		flagErrs = append(flagErrs, "--geoip-db is required to filter by country or asn")
+	}
+
+	fetcherOpts := fetcher.Options{
+		Retry: fetcher.RetryPolicy{
+			Attempts:  *sourceRetries,
+			BaseDelay: *sourceRetryDelay,
+			MaxDelay:  *sourceRetryMaxDelay,
+		},
+	}
+	if p, err := fetcher.ParseErrorPolicy(*onSourceError); err != nil {
+		flagErrs = append(flagErrs, fmt.Sprintf("--on-source-error: %v", err))
+	} else {
+		fetcherOpts.OnError = p
+	}
+
+	if *execGoAccess && *outFmt != "goaccess" {
+		flagErrs = append(flagErrs, "--exec-goaccess requires --out-format goaccess")
+	}
+	if *execGoAccess && *output != "" && *execGoAccessInterval == 0 {
+		flagErrs = append(flagErrs, "--output can only be used with --exec-goaccess together with --exec-goaccess-interval")
+	}
+	if *execGoAccessInterval < 0 {
+		flagErrs = append(flagErrs, "--exec-goaccess-interval must not be negative")
+	}
+
+	if *geoipCountryField == "username" && *anonymizeUser != "" {
+		flagErrs = append(flagErrs, "--geoip-country-field username can not be used with --anonymize-user, the country would be anonymized")
+	}
+	if *keepSourceFields && (*anonymizeIP != "" || *anonymizeUser != "") {
+		flagErrs = append(flagErrs, "--keep-source-fields can not be used with --anonymize-ip or --anonymize-user, the source fields contain the original ips and users")
+	}
+	if *outFmt == "parquet" && len(*outSplitBy) == 0 && (*outAppend || *stateFile != "") {
+		flagErrs = append(flagErrs, "parquet files can not be appended to, --out-append and --state-file require --parquet-hive-partition or --out-split-by with {part} in --output")
+	}
+	if *outFmt == "parquet" && len(*outSplitBy) > 0 && !strings.Contains(*output, "{part}") {
+		flagErrs = append(flagErrs, "parquet files can not be appended to, --out-split-by requires {part} in --output")
+	}
+	if *outFmt == "sqlite" && *output == "" {
+		flagErrs = append(flagErrs, "--out-format sqlite requires --output with the path of the database")
+	}
+	if *outFmt == "sqlite" && len(*outSplitBy) > 0 {
+		flagErrs = append(flagErrs, "--out-split-by can not be used with --out-format sqlite")
+	}
+	if len(*outSplitBy) > 0 && *output == "" {
+		flagErrs = append(flagErrs, "--out-split-by requires --output with the path template")
+	}
+	if len(*outSplitBy) > 0 && *execGoAccess {
+		flagErrs = append(flagErrs, "--out-split-by can not be used with --exec-goaccess")
+	}
+
+	if cmd == "report" || cmd == "serve-metrics" {
+		if *execGoAccess || len(*outSplitBy) > 0 || *stateFile != "" || *validateOutput {
+			flagErrs = append(flagErrs, fmt.Sprintf("--exec-goaccess, --out-split-by, --state-file and --validate-output can not be used with the %s command", cmd))
+		}
+	}
+	if cmd == "report" && !contains(report.Formats(), *reportFormat) {
+		flagErrs = append(flagErrs, fmt.Sprintf("--report-format must be one of %s", strings.Join(report.Formats(), ", ")))
+	}
+	if cmd == "serve-metrics" && *output != "" {
+		flagErrs = append(flagErrs, "--output can not be used with the serve-metrics command")
+	}
+
+	if *validateOutput && *outFmt != "goaccess" {
+		flagErrs = append(flagErrs, "--validate-output requires --out-format goaccess")
+	}
+
+	if *summaryFormat != "text" && *summaryFormat != "json" {
+		flagErrs = append(flagErrs, "--summary-format must be one of text, json")
+	}
 
 	if len(flagErrs) > 0 {
 		for _, e := range flagErrs {
@@ -80,118 +323,427 @@ func main() {
 		os.Exit(1)
 	}
 
+	if cmd == "ls" {
+		pred, err := filterConf.Predicate()
+		if err != nil {
+			panic(err)
+		}
+		fetcherOpts.Predicate = pred
+		ctx, _ := signalContext()
+		if err := listLocations(ctx, os.Stdout, locations, fetcherOpts); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	normalizers, err := normalizer.AddIfNotEmpty([]normalizer.Normalizer{}, *normalizeURLs, normalizer.NewURLNormalizer)
 	if err != nil {
 		panic(err)
 	}
 
-	err = run(*inFmt, flag.Args(), filterConf, normalizers, os.Stdout)
-	if err != nil {
-		panic(err)
+	for _, f := range *rewriteRules {
+		rules, err := normalizer.LoadRewriteRules(f)
+		if err != nil {
+			panic(err)
+		}
+		n, err := normalizer.NewRewriteNormalizer(rules)
+		if err != nil {
+			panic(fmt.Errorf("%s: %w", f, err))
+		}
+		normalizers = append(normalizers, n)
 	}
-}
 
-type stats struct {
-	read     int
-	skipped  int
-	included int
-}
+	queryConf := normalizer.QueryConf{
+		DropAll: *queryDropAll,
+		Keep:    *queryKeep,
+		Drop:    *queryDrop,
+		Sort:    *querySort,
+		Redact:  *queryRedact,
+	}
+	if !queryConf.IsEmpty() {
+		n, err := normalizer.NewQueryNormalizer(queryConf)
+		if err != nil {
+			panic(err)
+		}
+		normalizers = append(normalizers, n)
+	}
 
-func run(inFmt string, locations []string, filterConf filter.FilterConf, normalizers []normalizer.Normalizer, out io.Writer) error {
-	filter, err := filterConf.Build()
-	if err != nil {
-		return err
+	if *templatePaths || *templateRoutes != "" {
+		routes := []string{}
+		if *templateRoutes != "" {
+			routes, err = normalizer.LoadRoutes(*templateRoutes)
+			if err != nil {
+				panic(err)
+			}
+		}
+		n, err := normalizer.NewPathTemplateNormalizer(routes)
+		if err != nil {
+			panic(err)
+		}
+		normalizers = append(normalizers, n)
 	}
 
-	in, err := fetcher.ForLocations(locations, filterConf)
-	if err != nil {
-		return err
+	refererConf := normalizer.RefererConf{
+		Mode:           *refererMode,
+		DecodePunycode: *refererPunycode,
+		DropInternal:   *refererDropInternal,
+		OwnDomains:     *refererOwnDomains,
+	}
+	if !refererConf.IsEmpty() {
+		n, err := normalizer.NewRefererNormalizer(refererConf)
+		if err != nil {
+			panic(err)
+		}
+		normalizers = append(normalizers, n)
 	}
 
-	tfmr, err := transformer.ForName(inFmt)
+	var anonymizeKey []byte
+	if *anonymizeKeyFile != "" {
+		anonymizeKey, err = os.ReadFile(*anonymizeKeyFile)
+		if err != nil {
+			panic(err)
+		}
+		anonymizeKey = bytes.TrimSpace(anonymizeKey)
+	}
+	switch *anonymizeIP {
+	case "":
+	case "truncate":
+		n, err := normalizer.NewIPTruncateNormalizer(*anonymizeIPv4Bits, *anonymizeIPv6Bits)
+		if err != nil {
+			panic(err)
+		}
+		normalizers = append(normalizers, n)
+	case "pseudonymize":
+		n, err := normalizer.NewIPPseudonymNormalizer(anonymizeKey, *anonymizeRotation)
+		if err != nil {
+			panic(err)
+		}
+		normalizers = append(normalizers, n)
+	default:
+		panic(fmt.Errorf("unknown client ip anonymization '%s', possible values are: truncate, pseudonymize", *anonymizeIP))
+	}
+	if *anonymizeUser != "" {
+		n, err := normalizer.NewUsernameNormalizer(*anonymizeUser, anonymizeKey)
+		if err != nil {
+			panic(err)
+		}
+		normalizers = append(normalizers, n)
+	}
+
+	resolver, err := clientip.New(*trustedProxies, *clientIPHeaders)
 	if err != nil {
-		return err
+		panic(err)
+	}
+	var untrustedOnce sync.Once
+	resolver.OnUntrustedHeader = func(peer, header string) {
+		untrustedOnce.Do(func() {
+			fmt.Fprintf(os.Stderr, "warning: requests from %s contain %s but no --trusted-proxy is set, using the proxy as client ip\n", peer, header)
+		})
 	}
+	tfmrOpts := transformer.Options{ClientIP: resolver, KeepSourceFields: *keepSourceFields}
 
-	statsT := time.NewTicker(time.Second * 5)
+	enrichers := []normalizer.Normalizer{}
+	var geo *geoip.Enricher
+	if len(*geoipDBs) > 0 {
+		geo, err = geoip.Open(*geoipDBs, *geoipCountryField)
+		if err != nil {
+			panic(err)
+		}
+		defer geo.Close()
+		enrichers = append(enrichers, geo.Enrich)
+	}
 
-	statsC := make(chan stats)
-	quitC := make(chan struct{})
-	defer func() {
-		statsT.Stop()
-		quitC <- struct{}{}
-	}()
+	scale := 1.
+	if *sampleScale && filterConf.SampleRate > 0 {
+		scale = 1 / filterConf.SampleRate
+	}
 
-	go func() {
-		stat := stats{}
-		lastStat := stat
-		lastTime := time.Now()
-		for {
-			select {
-			case s := <-statsC:
-				stat = s
-			case t := <-statsT.C:
-				delta := stat.read - lastStat.read
-				avg := float64(delta) / t.Sub(lastTime).Seconds()
-				fmt.Fprintf(os.Stderr, "%d lines read (~%.0f/sec), %d included, %d skipped\n", stat.read, avg, stat.included, stat.skipped)
-				lastStat = stat
-				lastTime = t
-			case <-quitC:
-				return
-			}
+	var resume *fetcher.Progress
+	if *stateFile != "" {
+		resume, err = loadState(*stateFile)
+		if err != nil {
+			panic(err)
 		}
-	}()
+	}
 
-	stat := stats{}
-	start := time.Now()
-	// read all lines
-	for {
-		statsC <- stat
-		line, ok, err := in.Next()
+	newSink := func(w io.Writer, appending bool) (sink.Sink, error) {
+		if *outFmt == "parquet" {
+			return sink.NewParquet(w, sink.ParquetOptions{Compression: *parquetCompression, RowGroupRows: *parquetRowGroupRows})
+		}
+		snk, err := sink.ForName(*outFmt, w)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if !ok {
-			break
+		switch t := snk.(type) {
+		case *sink.GoAccess:
+			t.Layout = layout
+			if *validateOutput {
+				t.OnEscaped = func(line string) {
+					fmt.Fprintln(os.Stderr, "ESCAPED", line)
+				}
+			}
+		case *sink.CSV:
+			if appending {
+				t.SkipHeader()
+			}
 		}
-		stat.read++
+		return snk, nil
+	}
 
-		gl, skip, err := tfmr.Parse(line)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "TRANSFORM", err, line)
-			stat.skipped++
-			continue
+	appending := resume != nil || *outAppend
+	var out io.Writer = os.Stdout
+	// split and sqlite output open their files themselves
+	opensOutput := len(*outSplitBy) == 0 && (*outFmt != "sqlite" || cmd == "report") && cmd != "serve-metrics"
+	if *output != "" && opensOutput {
+		mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if appending {
+			mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
 		}
-		if skip {
-			stat.skipped++
-			continue
+		f, err := os.OpenFile(*output, mode, 0644)
+		if err != nil {
+			panic(err)
 		}
+		defer f.Close()
+		out = f
+	}
 
-		if !filter(gl) {
-			stat.skipped++
-			continue
+	var gp *goaccessProcess
+	if *execGoAccess {
+		args := goaccessArgs(layout, goaccessExtraArgs)
+		if *execGoAccessInterval > 0 {
+			spool, removeSpool := out.(*os.File), false
+			if *output == "" {
+				spool, err = os.CreateTemp("", "logs2goaccess-*.log")
+				if err != nil {
+					panic(err)
+				}
+				defer spool.Close()
+				out, removeSpool = spool, true
+			}
+			gp = rerunGoAccess(*execGoAccessBin, args, spool, removeSpool, *execGoAccessInterval)
+		} else {
+			gp, out, err = streamToGoAccess(*execGoAccessBin, args)
+			if err != nil {
+				panic(err)
+			}
 		}
-		stat.included++
+	}
 
-		for _, normalize := range normalizers {
-			gl, err = normalize(gl)
-			if err != nil {
-				fmt.Fprintln(out, "NORMALIZE", err, line)
-				return err
+	ctx, sig := signalContext()
+	if gp != nil {
+		go func() {
+			<-ctx.Done()
+			if s := sig(); s != nil {
+				gp.Signal(s)
 			}
+		}()
+	}
+	var snk sink.Sink
+	var agg *report.Aggregator
+	var srv *http.Server
+	if cmd == "report" {
+		agg = report.NewAggregator(*reportMaxKeys)
+		snk = agg
+	} else if cmd == "serve-metrics" {
+		exp, err := metrics.New(metrics.Options{Labels: *metricsLabels, MaxSeries: *metricsMaxSeries, Buckets: *metricsBuckets})
+		if err != nil {
+			panic(err)
+		}
+		srv, err = serveMetrics(*metricsListen, exp)
+		if err != nil {
+			panic(err)
 		}
-		_, err = out.Write([]byte(gl.ToGoAccess()))
+		snk = exp
+	} else if *outFmt == "sqlite" {
+		snk, err = sink.NewSQLite(*output, appending)
+	} else if len(*outSplitBy) > 0 {
+		snk, err = sink.NewSplit(*output, *outSplitBy, *outMaxOpen, appending, newSink)
+	} else {
+		snk, err = newSink(out, appending)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if ga, ok := snk.(*sink.GoAccess); ok && gp != nil && gp.spool != nil {
+		ss := &spoolSink{GoAccess: ga}
+		gp.FlushWith(ss.Flush)
+		snk = ss
+	}
+
+	err = run(ctx, *inFmt, tfmrOpts, fetcherOpts, locations, filterConf, enrichers, normalizers, scale, *summaryFormat, resume, *stateFile, snk, *validateOutput, *anonymizeIP != "" || *anonymizeUser != "")
+	if geo != nil && geo.Failed() > 0 {
+		fmt.Fprintf(os.Stderr, "%d geoip lookups failed, the country and asn of those lines are empty\n", geo.Failed())
+	}
+	if srv != nil {
+		// keep serving the final values until stopped
+		if err == nil && sig() == nil {
+			fmt.Fprintf(os.Stderr, "all locations read, serving metrics on %s until stopped\n", *metricsListen)
+			<-ctx.Done()
+			err = srv.Shutdown(context.Background())
+		} else {
+			srv.Close()
+		}
+	}
+	goaccessCode := 0
+	if gp != nil {
+		var gerr error
+		goaccessCode, gerr = gp.Wait(err == nil && sig() == nil)
+		if gerr != nil && err == nil {
+			err = gerr
+		}
+	}
+	if s := sig(); s != nil {
+		fmt.Fprintf(os.Stderr, "stopped by %s\n", s)
+		os.Exit(128 + int(s.(syscall.Signal)))
+	}
+	// the output can not be written if goaccess exited early, its exit code tells more
+	if goaccessCode != 0 {
 		if err != nil {
-			return err
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(goaccessCode)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if agg != nil {
+		if err := report.Write(out, *reportFormat, agg.Report(*reportTop)); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// serveMetrics serves the metrics of exp on /metrics in the background
+func serveMetrics(addr string, exp *metrics.Exporter) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp.Handler())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			fmt.Fprintln(os.Stderr, "serving metrics failed:", err)
+		}
+	}()
+	return srv, nil
+}
+
+func contains(vv []string, v string) bool {
+	for _, e := range vv {
+		if e == v {
+			return true
 		}
-		_, err = out.Write([]byte("\n"))
+	}
+	return false
+}
+
+// signalContext returns a context which is canceled on SIGINT or SIGTERM, and a function returning
+// the signal received. A second signal terminates the process immediately.
+func signalContext() (context.Context, func() os.Signal) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigC := make(chan os.Signal, 1)
+	signal.Notify(sigC, os.Interrupt, syscall.SIGTERM)
+
+	var mu sync.Mutex
+	var received os.Signal
+	go func() {
+		s := <-sigC
+		signal.Stop(sigC)
+		mu.Lock()
+		received = s
+		mu.Unlock()
+		cancel()
+	}()
+	return ctx, func() os.Signal {
+		mu.Lock()
+		defer mu.Unlock()
+		return received
+	}
+}
+
+func run(ctx context.Context, inFmt string, tfmrOpts transformer.Options, fetcherOpts fetcher.Options, locations []string, filterConf filter.FilterConf, enrichers []normalizer.Normalizer, normalizers []normalizer.Normalizer, scale float64, summaryFormat string, resume *fetcher.Progress, stateFile string, snk sink.Sink, validateOutput bool, anonymized bool) error {
+	pred, err := filterConf.Predicate()
+	if err != nil {
+		return err
+	}
+
+	fetcherOpts.Predicate = pred
+	in, err := fetcher.ForLocations(ctx, locations, fetcherOpts)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if resume != nil {
+		fmt.Fprintf(os.Stderr, "resuming after %d completed locations\n", len(resume.Completed))
+		in.Resume(*resume)
+	}
+
+	tfmr, err := transformer.ForName(inFmt, tfmrOpts)
+	if err != nil {
+		return err
+	}
+
+	lastStat := pipeline.Stats{}
+	lastTime := time.Now()
+	p := &pipeline.Pipeline{
+		Fetcher:     in,
+		Transformer: tfmr,
+		Enrichers:   enrichers,
+		Filter:      pred,
+		Normalizers: normalizers,
+		Sink:        snk,
+		Hooks: pipeline.Hooks{
+			OnParseError: func(line string, err error) {
+				// the raw line and the parse error may contain the ips and users to anonymize
+				if anonymized {
+					loc, n := in.Position()
+					fmt.Fprintf(os.Stderr, "TRANSFORM could not parse line %d of %s\n", n, loc)
+					return
+				}
+				fmt.Fprintln(os.Stderr, "TRANSFORM", err, line)
+			},
+		},
+		StatsInterval: 5 * time.Second,
+		OnStats: func(stat pipeline.Stats) {
+			now := time.Now()
+			avg := float64(stat.Read-lastStat.Read) / now.Sub(lastTime).Seconds()
+			fmt.Fprintf(os.Stderr, "%d lines read (~%.0f/sec), %d included, %d skipped\n", stat.Read, avg, stat.Included, stat.Skipped)
+			lastStat = stat
+			lastTime = now
+		},
+	}
+
+	start := time.Now()
+	stat, err := p.Run(ctx)
+	if stateFile != "" {
+		// keep the progress of unfinished runs, so they can be resumed
 		if err != nil {
-			return err
+			if serr := saveState(stateFile, in.Progress()); serr != nil {
+				fmt.Fprintln(os.Stderr, "could not save state:", serr)
+			}
+		} else if rerr := os.Remove(stateFile); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			return rerr
 		}
+	}
+	var escaped *int
+	if ec, ok := snk.(interface{ Escaped() int }); ok && validateOutput {
+		n := ec.Escaped()
+		escaped = &n
+	}
+	if serr := printSummary(os.Stderr, summaryFormat, stat, in.Skipped(), escaped, time.Since(start), scale); serr != nil && err == nil {
+		err = serr
+	}
+	return err
+}
 
+func upper(vv []string) []string {
+	u := []string{}
+	for _, v := range vv {
+		u = append(u, strings.ToUpper(v))
 	}
-	fmt.Fprintf(os.Stderr, "%d lines read in %s\n", stat.read, time.Since(start))
-	return nil
+	return u
 }
 
 func tryParseDate(v string) (*time.Time, error) {
@@ -0,0 +1,165 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Overflow replaces the label values of series exceeding Options.MaxSeries
+const Overflow = "other"
+
+// labels which can be used, url is the path only, so it should be normalized (e.g. --template-paths)
+var labels = map[string]func(l *goaccess.Line) string{
+	"vhost":        func(l *goaccess.Line) string { return l.VHost },
+	"method":       func(l *goaccess.Line) string { return l.Method },
+	"status":       func(l *goaccess.Line) string { return strconv.Itoa(l.ResponseStatus) },
+	"status_class": func(l *goaccess.Line) string { return strconv.Itoa(l.ResponseStatus/100) + "xx" },
+	"protocol":     func(l *goaccess.Line) string { return l.Protocol },
+	"cache_status": func(l *goaccess.Line) string { return l.CacheStatus },
+	"country":      func(l *goaccess.Line) string { return l.Country },
+	"url":          func(l *goaccess.Line) string { return l.URL },
+}
+
+// DefaultLabels keep the cardinality low
+var DefaultLabels = []string{"vhost", "method", "status_class"}
+
+// Labels returns the names of all labels which can be used
+func Labels() []string {
+	names := []string{}
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Options configure the exported metrics
+type Options struct {
+	// Labels of the request metrics, see Labels
+	Labels []string
+	// MaxSeries limits the distinct label value combinations, lines of further combinations
+	// are counted with all labels set to Overflow
+	MaxSeries int
+	// Buckets of the latency histogram in seconds
+	Buckets []float64
+}
+
+// Exporter is a sink counting the lines as prometheus metrics
+type Exporter struct {
+	registry *prometheus.Registry
+	values   []func(l *goaccess.Line) string
+	max      int
+	series   map[string]bool
+
+	requests  *prometheus.CounterVec
+	bytes     *prometheus.CounterVec
+	duration  *prometheus.HistogramVec
+	overflows prometheus.Counter
+	// requests without a duration, e.g. the ALB logs -1 if it could not reach a target
+	noDuration prometheus.Counter
+	lastSeen   prometheus.Gauge
+	latest     float64
+}
+
+func New(o Options) (*Exporter, error) {
+	e := &Exporter{registry: prometheus.NewRegistry(), max: o.MaxSeries, series: map[string]bool{}}
+	for _, n := range o.Labels {
+		fn, set := labels[n]
+		if !set {
+			return nil, fmt.Errorf("unknown label '%s', known labels: %v", n, Labels())
+		}
+		e.values = append(e.values, fn)
+	}
+	buckets := o.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	e.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logs2goaccess_http_requests_total",
+		Help: "Requests read from the logs.",
+	}, o.Labels)
+	e.bytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "logs2goaccess_http_response_size_bytes_total",
+		Help: "Bytes sent in responses to the requests read from the logs.",
+	}, o.Labels)
+	e.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "logs2goaccess_http_request_duration_seconds",
+		Help:    "Time taken to serve the requests read from the logs.",
+		Buckets: buckets,
+	}, o.Labels)
+	e.overflows = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logs2goaccess_series_overflow_total",
+		Help: "Requests counted with the labels set to \"" + Overflow + "\" because there were too many series.",
+	})
+	e.noDuration = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logs2goaccess_http_requests_without_duration_total",
+		Help: "Requests not observed in the duration histogram because the logs have no duration for them.",
+	})
+	e.lastSeen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "logs2goaccess_last_request_timestamp_seconds",
+		Help: "Time of the latest request read from the logs.",
+	})
+
+	e.registry.MustRegister(
+		e.requests, e.bytes, e.duration, e.overflows, e.noDuration, e.lastSeen,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return e, nil
+}
+
+// Handler serves the metrics in the Prometheus text or the OpenMetrics format
+func (e *Exporter) Handler() http.Handler {
+	return promhttp.HandlerFor(e.registry, promhttp.HandlerOpts{EnableOpenMetrics: true})
+}
+
+func (e *Exporter) labelValues(l *goaccess.Line) []string {
+	values := make([]string, len(e.values))
+	for i, fn := range e.values {
+		values[i] = fn(l)
+	}
+	key := strings.Join(values, "\x00")
+	if e.series[key] {
+		return values
+	}
+	if e.max > 0 && len(e.series) >= e.max {
+		e.overflows.Inc()
+		for i := range values {
+			values[i] = Overflow
+		}
+		return values
+	}
+	e.series[key] = true
+	return values
+}
+
+func (e *Exporter) Write(l *goaccess.Line) error {
+	values := e.labelValues(l)
+	e.requests.WithLabelValues(values...).Inc()
+	e.bytes.WithLabelValues(values...).Add(float64(l.ResponseSize))
+	if l.RequestDuration < 0 {
+		e.noDuration.Inc()
+	} else {
+		e.duration.WithLabelValues(values...).Observe(float64(l.RequestDuration) / float64(time.Second))
+	}
+	// lines are not necessarily ordered
+	if ts := float64(l.Timestamp.UnixMilli()) / 1000; ts > e.latest {
+		e.latest = ts
+		e.lastSeen.Set(ts)
+	}
+	return nil
+}
+
+func (e *Exporter) Close() error {
+	return nil
+}
@@ -0,0 +1,121 @@
+package normalizer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+// NewIPTruncateNormalizer keeps only the first v4Bits of IPv4 and v6Bits of IPv6 client ips,
+// including every hop of the forwarded for chain. Ips which can not be parsed are removed.
+func NewIPTruncateNormalizer(v4Bits, v6Bits int) (Normalizer, error) {
+	if v4Bits < 0 || v4Bits > 32 {
+		return nil, fmt.Errorf("IPv4 prefix length must be between 0 and 32, got %d", v4Bits)
+	}
+	if v6Bits < 0 || v6Bits > 128 {
+		return nil, fmt.Errorf("IPv6 prefix length must be between 0 and 128, got %d", v6Bits)
+	}
+	v4Mask := net.CIDRMask(v4Bits, 32)
+	v6Mask := net.CIDRMask(v6Bits, 128)
+	truncate := func(s string) string {
+		ip := net.ParseIP(s)
+		switch {
+		case ip == nil:
+			return ""
+		case ip.To4() != nil:
+			return ip.To4().Mask(v4Mask).String()
+		}
+		return ip.Mask(v6Mask).String()
+	}
+	return func(l *goaccess.Line) (*goaccess.Line, error) {
+		l.ClientIP = truncate(l.ClientIP)
+		l.ForwardedFor = mapHops(l.ForwardedFor, truncate)
+		return l, nil
+	}, nil
+}
+
+// NewIPPseudonymNormalizer replaces the client ip with a keyed HMAC of it. The pseudonym stays
+// the same for all requests within a rotation window (based on the request time), a rotation of
+// 0 never rotates. Pseudonyms are formatted as IPv6 addresses in fd00::/8 so goaccess still
+// accepts them as hosts. Every hop of the forwarded for chain is replaced as well.
+func NewIPPseudonymNormalizer(key []byte, rotation time.Duration) (Normalizer, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("a key is required to pseudonymize client ips")
+	}
+	return func(l *goaccess.Line) (*goaccess.Line, error) {
+		window := rotationWindow(l.Timestamp, rotation)
+		pseudonymize := func(s string) string {
+			sum := keyedHash(key, window, s)
+			ip := make(net.IP, net.IPv6len)
+			ip[0] = 0xfd
+			copy(ip[1:], sum)
+			return ip.String()
+		}
+		l.ClientIP = pseudonymize(l.ClientIP)
+		l.ForwardedFor = mapHops(l.ForwardedFor, pseudonymize)
+		return l, nil
+	}, nil
+}
+
+// mapHops applies fn to every hop of a forwarded for chain, hops mapped to "" are removed
+func mapHops(chain string, fn func(string) string) string {
+	if chain == "" {
+		return ""
+	}
+	hops := []string{}
+	for _, h := range strings.Split(chain, ",") {
+		if h = fn(strings.TrimSpace(h)); h != "" {
+			hops = append(hops, h)
+		}
+	}
+	return strings.Join(hops, ", ")
+}
+
+// NewUsernameNormalizer removes ("strip") or pseudonymizes ("hash") the user portion of the
+// username. For usernames like user@domain, the domain is kept.
+func NewUsernameNormalizer(mode string, key []byte) (Normalizer, error) {
+	var anonymize func(string) string
+	switch mode {
+	case "strip":
+		anonymize = func(string) string { return "" }
+	case "hash":
+		if len(key) == 0 {
+			return nil, fmt.Errorf("a key is required to hash usernames")
+		}
+		anonymize = func(u string) string { return hex.EncodeToString(keyedHash(key, 0, u)[:8]) }
+	default:
+		return nil, fmt.Errorf("unknown username anonymization '%s', possible values are: strip, hash", mode)
+	}
+	return func(l *goaccess.Line) (*goaccess.Line, error) {
+		if l.Username == "" || l.Username == "-" {
+			return l, nil
+		}
+		user, domain := l.Username, ""
+		if i := strings.LastIndex(l.Username, "@"); i >= 0 {
+			user, domain = l.Username[:i], l.Username[i:]
+		}
+		l.Username = anonymize(user) + domain
+		return l, nil
+	}, nil
+}
+
+func rotationWindow(t time.Time, rotation time.Duration) int64 {
+	if rotation <= 0 {
+		return 0
+	}
+	return t.UnixNano() / int64(rotation)
+}
+
+func keyedHash(key []byte, window int64, v string) []byte {
+	mac := hmac.New(sha256.New, key)
+	binary.Write(mac, binary.BigEndian, window)
+	mac.Write([]byte(v))
+	return mac.Sum(nil)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/floj/logs2goaccess/goaccess"
 )
 
+// Normalizer modifies a line, it may return nil to drop the line
 type Normalizer func(*goaccess.Line) (*goaccess.Line, error)
 
 func AddIfNotEmpty(normalizer []Normalizer, v []string, fn func([]string) (Normalizer, error)) ([]Normalizer, error) {
@@ -43,7 +44,7 @@ func NewURLNormalizer(s []string) (Normalizer, error) {
 	}
 	return func(l *goaccess.Line) (*goaccess.Line, error) {
 		for i := range match {
-			l.URL = match[i].ReplaceAllString(l.URL, replace[i])
+			l.SetRequestURI(match[i].ReplaceAllString(l.RequestURI(), replace[i]))
 		}
 		return l, nil
 	}, nil
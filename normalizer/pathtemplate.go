@@ -0,0 +1,147 @@
+package normalizer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+// segment patterns recognized by the path templating, the first match wins
+var segmentTemplates = []struct {
+	placeholder string
+	match       func(string) bool
+}{
+	{"{uuid}", regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`).MatchString},
+	{"{date}", regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`).MatchString},
+	{"{id}", regexp.MustCompile(`^\d+$`).MatchString},
+	{"{hash}", regexp.MustCompile(`^[0-9a-fA-F]{16,}$`).MatchString},
+	{"{token}", isToken},
+}
+
+var tokenRe = regexp.MustCompile(`^[A-Za-z0-9_]{20,}={0,2}$`)
+
+// isToken matches base64-ish strings, mixing upper and lower case letters and digits. Segments
+// with - are slugs like release-notes-for-2023-q4 and no tokens.
+func isToken(s string) bool {
+	return tokenRe.MatchString(s) &&
+		strings.ContainsAny(s, "0123456789") &&
+		strings.ContainsAny(s, "abcdefghijklmnopqrstuvwxyz") &&
+		strings.ContainsAny(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+}
+
+// NewPathTemplateNormalizer replaces IDs in the path of the url by placeholders like
+// /users/{id}/orders/{uuid}. Paths matching one of the routes are replaced by the route instead.
+func NewPathTemplateNormalizer(routes []string) (Normalizer, error) {
+	rr := []route{}
+	for _, r := range routes {
+		rr = append(rr, newRoute(r))
+	}
+	// prefer the most specific route
+	sort.SliceStable(rr, func(i, j int) bool { return rr[i].literals > rr[j].literals })
+
+	return func(l *goaccess.Line) (*goaccess.Line, error) {
+		segments := strings.Split(l.URL, "/")
+
+		for _, r := range rr {
+			if r.match(segments) {
+				l.URL = r.pattern
+				return l, nil
+			}
+		}
+
+		for i, s := range segments {
+			for _, t := range segmentTemplates {
+				if s != "" && t.match(s) {
+					segments[i] = t.placeholder
+					break
+				}
+			}
+		}
+		l.URL = strings.Join(segments, "/")
+		return l, nil
+	}, nil
+}
+
+type route struct {
+	pattern  string
+	segments []string
+	// number of segments which are not placeholders
+	literals int
+}
+
+func newRoute(pattern string) route {
+	r := route{pattern: pattern, segments: strings.Split(pattern, "/")}
+	for _, s := range r.segments {
+		if !isPlaceholder(s) {
+			r.literals++
+		}
+	}
+	return r
+}
+
+func isPlaceholder(s string) bool {
+	return strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")
+}
+
+func (r route) match(segments []string) bool {
+	if len(segments) != len(r.segments) {
+		return false
+	}
+	for i, s := range r.segments {
+		if isPlaceholder(s) {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if s != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadRoutes reads route patterns like /users/{id} from a file. OpenAPI specs (.json, .yaml, .yml)
+// contribute their paths, any other file is read as a list of patterns, one per line.
+func LoadRoutes(file string) ([]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json", ".yaml", ".yml":
+		spec := struct {
+			Paths map[string]interface{} `yaml:"paths"`
+		}{}
+		if err := yaml.Unmarshal(data, &spec); err != nil {
+			return nil, fmt.Errorf("could not parse OpenAPI spec '%s': %w", file, err)
+		}
+		routes := []string{}
+		for p := range spec.Paths {
+			routes = append(routes, p)
+		}
+		sort.Strings(routes)
+		return routes, nil
+	}
+
+	routes := []string{}
+	scn := bufio.NewScanner(bytes.NewReader(data))
+	for scn.Scan() {
+		line := strings.TrimSpace(scn.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		routes = append(routes, line)
+	}
+	return routes, scn.Err()
+}
@@ -0,0 +1,43 @@
+package normalizer
+
+import (
+	"testing"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+func TestPathTemplateSegments(t *testing.T) {
+	n, err := NewPathTemplateNormalizer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"uuid", "/orders/3f2504e0-4f89-11d3-9a0c-0305e82c3301", "/orders/{uuid}"},
+		{"date", "/archive/2023-10-17/index.html", "/archive/{date}/index.html"},
+		{"id", "/users/12345/orders", "/users/{id}/orders"},
+		{"hash with extension", "/static/d41d8cd98f00b204e9800998ecf8427e.js", "/static/d41d8cd98f00b204e9800998ecf8427e.js"},
+		{"hash", "/commits/d41d8cd98f00b204e9800998ecf8427e", "/commits/{hash}"},
+		{"token", "/reset/eyJhbGciOiJIUzI1NiJ9", "/reset/{token}"},
+		{"padded token", "/verify/dGhpcyBpcyBhIHRva2Vu==", "/verify/{token}"},
+		{"slug", "/blog/release-notes-for-2023-q4", "/blog/release-notes-for-2023-q4"},
+		{"mixed case slug", "/blog/Release-Notes-For-2023-Q4", "/blog/Release-Notes-For-2023-Q4"},
+		{"long word", "/docs/internationalization", "/docs/internationalization"},
+		{"lower case with digits", "/docs/internationalization2023", "/docs/internationalization2023"},
+		{"root", "/", "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := n(&goaccess.Line{URL: tt.url})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l.URL != tt.want {
+				t.Errorf("got %s, want %s", l.URL, tt.want)
+			}
+		})
+	}
+}
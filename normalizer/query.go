@@ -0,0 +1,138 @@
+package normalizer
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+const redacted = "REDACTED"
+
+// QueryConf configures the query string normalizer. Keys are matched case-insensitive and
+// may contain glob patterns like utm_*.
+type QueryConf struct {
+	// DropAll removes the whole query string
+	DropAll bool
+	// Keep only keeps the matching parameters
+	Keep []string
+	// Drop removes the matching parameters
+	Drop []string
+	// Sort orders the parameters by key, so the same parameters in a different order are grouped together
+	Sort bool
+	// Redact replaces the values of the matching parameters
+	Redact []string
+}
+
+func (c QueryConf) IsEmpty() bool {
+	return !c.DropAll && len(c.Keep) == 0 && len(c.Drop) == 0 && !c.Sort && len(c.Redact) == 0
+}
+
+func NewQueryNormalizer(c QueryConf) (Normalizer, error) {
+	keep, err := compileGlobs(c.Keep)
+	if err != nil {
+		return nil, err
+	}
+	drop, err := compileGlobs(c.Drop)
+	if err != nil {
+		return nil, err
+	}
+	redact, err := compileGlobs(c.Redact)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(l *goaccess.Line) (*goaccess.Line, error) {
+		if l.Query == "" {
+			return l, nil
+		}
+		if c.DropAll {
+			l.Query = ""
+			return l, nil
+		}
+
+		params := []queryParam{}
+		for _, raw := range strings.Split(l.Query, "&") {
+			if raw == "" {
+				continue
+			}
+			qp := newQueryParam(raw)
+			if len(keep) > 0 && !keep.match(qp.key) {
+				continue
+			}
+			if drop.match(qp.key) {
+				continue
+			}
+			if redact.match(qp.key) && qp.hasValue {
+				qp.rawValue = redacted
+			}
+			params = append(params, qp)
+		}
+		if c.Sort {
+			sort.SliceStable(params, func(i, j int) bool { return params[i].key < params[j].key })
+		}
+
+		parts := []string{}
+		for _, qp := range params {
+			parts = append(parts, qp.String())
+		}
+		l.Query = strings.Join(parts, "&")
+		return l, nil
+	}, nil
+}
+
+// queryParam keeps the raw key and value, so parameters which are not touched are written as they were logged
+type queryParam struct {
+	rawKey   string
+	rawValue string
+	hasValue bool
+	// decoded and lowercased key for matching
+	key string
+}
+
+func newQueryParam(raw string) queryParam {
+	qp := queryParam{rawKey: raw}
+	if i := strings.Index(raw, "="); i >= 0 {
+		qp.rawKey, qp.rawValue, qp.hasValue = raw[:i], raw[i+1:], true
+	}
+	key, err := url.QueryUnescape(qp.rawKey)
+	if err != nil {
+		key = qp.rawKey
+	}
+	qp.key = strings.ToLower(key)
+	return qp
+}
+
+func (qp queryParam) String() string {
+	if !qp.hasValue {
+		return qp.rawKey
+	}
+	return qp.rawKey + "=" + qp.rawValue
+}
+
+type globs []string
+
+func compileGlobs(patterns []string) (globs, error) {
+	g := globs{}
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		// validate the pattern once, path.Match only reports bad patterns when matching
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid pattern: %w", p, err)
+		}
+		g = append(g, p)
+	}
+	return g, nil
+}
+
+func (g globs) match(key string) bool {
+	for _, p := range g {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package normalizer
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+// RefererConf configures the referer normalizer
+type RefererConf struct {
+	// Mode reduces the referer: 'origin' keeps scheme and host, 'host-path' keeps host and path,
+	// 'strip-query' removes query and fragment. Empty keeps the referer as is.
+	Mode string
+	// DecodePunycode converts xn-- hosts to unicode
+	DecodePunycode bool
+	// DropInternal blanks referers to the VHost of the request
+	DropInternal bool
+	// OwnDomains blanks referers to these domains and their subdomains
+	OwnDomains []string
+}
+
+func (c RefererConf) IsEmpty() bool {
+	return c.Mode == "" && !c.DecodePunycode && !c.DropInternal && len(c.OwnDomains) == 0
+}
+
+var refererModes = map[string]func(u *url.URL, host string) string{
+	"origin":      func(u *url.URL, host string) string { return u.Scheme + "://" + host },
+	"host-path":   func(u *url.URL, host string) string { return host + u.EscapedPath() },
+	"strip-query": func(u *url.URL, host string) string { return u.Scheme + "://" + host + u.EscapedPath() },
+}
+
+func NewRefererNormalizer(c RefererConf) (Normalizer, error) {
+	reduce, set := refererModes[c.Mode]
+	if c.Mode != "" && !set {
+		return nil, fmt.Errorf("unknown referer mode '%s', possible values are: origin, host-path, strip-query", c.Mode)
+	}
+	ownDomains := []string{}
+	for _, d := range c.OwnDomains {
+		ownDomains = append(ownDomains, normalizeHost(d))
+	}
+
+	return func(l *goaccess.Line) (*goaccess.Line, error) {
+		if l.Referer == "" || l.Referer == "-" {
+			return l, nil
+		}
+		u, err := url.Parse(l.Referer)
+		if err != nil || u.Host == "" {
+			// keep what we can't make sense of
+			return l, nil
+		}
+
+		host := normalizeHost(u.Host)
+		if c.DropInternal && host == normalizeHost(l.VHost) {
+			l.Referer = ""
+			return l, nil
+		}
+		for _, d := range ownDomains {
+			if host == d || strings.HasSuffix(host, "."+d) {
+				l.Referer = ""
+				return l, nil
+			}
+		}
+
+		outHost := u.Host
+		if c.DecodePunycode {
+			if h, err := idna.ToUnicode(u.Hostname()); err == nil {
+				outHost = h
+				if p := u.Port(); p != "" {
+					outHost = net.JoinHostPort(h, p)
+				}
+			}
+		}
+		if reduce != nil {
+			l.Referer = reduce(u, outHost)
+		} else if outHost != u.Host {
+			l.Referer = withHost(u, outHost)
+		}
+		return l, nil
+	}, nil
+}
+
+// withHost formats u with host, unlike url.URL.String it does not escape unicode hosts
+func withHost(u *url.URL, host string) string {
+	b := strings.Builder{}
+	b.WriteString(u.Scheme + "://")
+	if u.User != nil {
+		b.WriteString(u.User.String() + "@")
+	}
+	b.WriteString(host)
+	b.WriteString(u.EscapedPath())
+	if u.ForceQuery || u.RawQuery != "" {
+		b.WriteString("?" + u.RawQuery)
+	}
+	if u.Fragment != "" {
+		b.WriteString("#" + u.EscapedFragment())
+	}
+	return b.String()
+}
+
+// normalizeHost lowercases the host and removes the port, so it can be compared to other hosts
+func normalizeHost(h string) string {
+	if host, _, err := net.SplitHostPort(h); err == nil {
+		h = host
+	}
+	return strings.TrimSuffix(strings.ToLower(h), ".")
+}
@@ -0,0 +1,140 @@
+package normalizer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+// RewriteRule changes a single field of a line, if the field matches Match (or Match is empty).
+// Exactly one of Replace, Set, Case or Drop has to be given.
+type RewriteRule struct {
+	Field string `yaml:"field"`
+	// Match is a regexp the field has to match for the rule to apply
+	Match string `yaml:"match"`
+	// Replace replaces all matches of Match, it can reference groups like $1
+	Replace *string `yaml:"replace"`
+	// Set replaces the whole field
+	Set *string `yaml:"set"`
+	// Case converts the field to 'lower' or 'upper' case
+	Case string `yaml:"case"`
+	// Drop removes the whole line
+	Drop bool `yaml:"drop"`
+}
+
+// LoadRewriteRules reads rules from a YAML (or JSON) file of the form
+//
+//	rules:
+//	  - field: vhost
+//	    match: '^www\.'
+//	    replace: ''
+func LoadRewriteRules(file string) ([]RewriteRule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	conf := struct {
+		Rules []RewriteRule `yaml:"rules"`
+	}{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&conf); err != nil {
+		return nil, fmt.Errorf("could not parse rewrite rules '%s': %w", file, err)
+	}
+	return conf.Rules, nil
+}
+
+type rewrite func(l *goaccess.Line, v string) (drop bool, err error)
+
+// NewRewriteNormalizer applies the rules in order. If a rule drops the line, nil is returned.
+func NewRewriteNormalizer(rules []RewriteRule) (Normalizer, error) {
+	type compiled struct {
+		field   string
+		match   *regexp.Regexp
+		rewrite rewrite
+	}
+	cc := []compiled{}
+	for i, r := range rules {
+		var re *regexp.Regexp
+		if r.Match != "" {
+			var err error
+			re, err = regexp.Compile(r.Match)
+			if err != nil {
+				return nil, fmt.Errorf("rewrite rule %d: '%s' is not a valid regexp: %w", i+1, r.Match, err)
+			}
+		}
+		c, err := r.compile(re)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite rule %d: %w", i+1, err)
+		}
+		cc = append(cc, compiled{field: r.Field, match: re, rewrite: c})
+	}
+
+	return func(l *goaccess.Line) (*goaccess.Line, error) {
+		for _, c := range cc {
+			v, err := l.Get(c.field)
+			if err != nil {
+				return nil, err
+			}
+			if c.match != nil && !c.match.MatchString(v) {
+				continue
+			}
+			drop, err := c.rewrite(l, v)
+			if err != nil {
+				return nil, err
+			}
+			if drop {
+				return nil, nil
+			}
+		}
+		return l, nil
+	}, nil
+}
+
+func (r RewriteRule) compile(re *regexp.Regexp) (rewrite, error) {
+	if !goaccess.IsField(r.Field) {
+		return nil, fmt.Errorf("unknown field '%s', known fields: %v", r.Field, goaccess.FieldNames())
+	}
+	actions := 0
+	for _, set := range []bool{r.Replace != nil, r.Set != nil, r.Case != "", r.Drop} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return nil, fmt.Errorf("exactly one of replace, set, case or drop is required")
+	}
+
+	switch {
+	case r.Replace != nil:
+		if re == nil {
+			return nil, fmt.Errorf("replace requires match")
+		}
+		return func(l *goaccess.Line, v string) (bool, error) {
+			return false, l.Set(r.Field, re.ReplaceAllString(v, *r.Replace))
+		}, nil
+	case r.Set != nil:
+		return func(l *goaccess.Line, v string) (bool, error) {
+			return false, l.Set(r.Field, *r.Set)
+		}, nil
+	case r.Case == "lower":
+		return func(l *goaccess.Line, v string) (bool, error) {
+			return false, l.Set(r.Field, strings.ToLower(v))
+		}, nil
+	case r.Case == "upper":
+		return func(l *goaccess.Line, v string) (bool, error) {
+			return false, l.Set(r.Field, strings.ToUpper(v))
+		}, nil
+	case r.Drop:
+		return func(l *goaccess.Line, v string) (bool, error) {
+			return true, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown case '%s', possible values are: lower, upper", r.Case)
+}
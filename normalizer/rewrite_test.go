@@ -0,0 +1,73 @@
+package normalizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+func TestRewriteRuleValidation(t *testing.T) {
+	empty := ""
+	tests := []struct {
+		name string
+		rule RewriteRule
+		err  string
+	}{
+		{"no action", RewriteRule{Field: "vhost", Match: "^www"}, "exactly one of"},
+		{"two actions", RewriteRule{Field: "vhost", Set: &empty, Drop: true}, "exactly one of"},
+		{"replace without match", RewriteRule{Field: "vhost", Replace: &empty}, "replace requires match"},
+		{"unknown field", RewriteRule{Field: "nope", Drop: true}, "unknown field 'nope'"},
+		{"unknown case", RewriteRule{Field: "vhost", Case: "title"}, "unknown case 'title'"},
+		{"invalid match", RewriteRule{Field: "vhost", Match: "(", Drop: true}, "not a valid regexp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRewriteNormalizer([]RewriteRule{tt.rule})
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want it to contain '%s'", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadRewriteRulesRejectsUnknownFields(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(file, []byte("rules:\n  - field: vhost\n    drop: true\n    replce: x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRewriteRules(file); err == nil || !strings.Contains(err.Error(), "replce") {
+		t.Errorf("got error %v, want it to name the unknown field", err)
+	}
+}
+
+func TestRewriteNormalizer(t *testing.T) {
+	empty, internal := "", "internal"
+	n, err := NewRewriteNormalizer([]RewriteRule{
+		{Field: "vhost", Match: `^www\.`, Replace: &empty},
+		{Field: "method", Case: "upper"},
+		{Field: "client_ip", Match: `^10\.`, Set: &internal},
+		{Field: "path", Match: `^/health$`, Drop: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := n(&goaccess.Line{VHost: "www.example.com", Method: "get", ClientIP: "10.0.0.1", URL: "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.VHost != "example.com" || l.Method != "GET" || l.ClientIP != "internal" {
+		t.Errorf("got vhost %s, method %s, client ip %s", l.VHost, l.Method, l.ClientIP)
+	}
+
+	l, err = n(&goaccess.Line{URL: "/health"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l != nil {
+		t.Errorf("got %+v, want the line to be dropped", l)
+	}
+}
@@ -0,0 +1,224 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/floj/logs2goaccess/fetcher"
+	"github.com/floj/logs2goaccess/filter"
+	"github.com/floj/logs2goaccess/goaccess"
+	"github.com/floj/logs2goaccess/normalizer"
+	"github.com/floj/logs2goaccess/sink"
+	"github.com/floj/logs2goaccess/transformer"
+)
+
+// reasons lines are skipped for besides the filter rules
+const (
+	ReasonParseError      = "parse-error"
+	ReasonTransformerSkip = "transformer-skip"
+	ReasonRewriteDrop     = "rewrite-drop"
+	ReasonDuplicate       = "duplicate"
+)
+
+type Stats struct {
+	Read     int
+	Skipped  int
+	Included int
+	// sum of the ResponseSize of all included lines
+	Bytes int64
+	// number of skipped lines by the reason they were skipped
+	Rejected map[string]int
+}
+
+// counters are updated by the pipeline without locking and may be read concurrently
+type counters struct {
+	read     atomic.Int64
+	skipped  atomic.Int64
+	included atomic.Int64
+	bytes    atomic.Int64
+	// reason -> *atomic.Int64
+	rejected sync.Map
+}
+
+func (c *counters) reject(reason string) {
+	n, ok := c.rejected.Load(reason)
+	if !ok {
+		n, _ = c.rejected.LoadOrStore(reason, new(atomic.Int64))
+	}
+	n.(*atomic.Int64).Add(1)
+	c.skipped.Add(1)
+}
+
+func (c *counters) snapshot() Stats {
+	s := Stats{
+		Skipped:  int(c.skipped.Load()),
+		Included: int(c.included.Load()),
+		Bytes:    c.bytes.Load(),
+		Rejected: map[string]int{},
+	}
+	c.rejected.Range(func(k, v any) bool {
+		s.Rejected[k.(string)] = int(v.(*atomic.Int64).Load())
+		return true
+	})
+	// read last, so it is never less than the lines counted above
+	s.Read = int(c.read.Load())
+	return s
+}
+
+// Hooks are called at the different stages of the pipeline, all of them are optional
+type Hooks struct {
+	// OnParseError is called for lines the transformer could not parse, those lines are skipped
+	OnParseError func(line string, err error)
+	// OnLine is called for every line before it is written to the sink
+	OnLine func(l *goaccess.Line)
+}
+
+// Pipeline reads lines from the Fetcher, parses them with the Transformer, enriches, filters and
+// normalizes them and writes them to the Sink.
+type Pipeline struct {
+	Fetcher     fetcher.Fetcher
+	Transformer transformer.Transformer
+	// Enrichers run before filtering, so filters can depend on the data they add
+	Enrichers []normalizer.Normalizer
+	// Filter decides which lines are written, nil includes all lines
+	Filter      filter.Predicate
+	Normalizers []normalizer.Normalizer
+	Sink        sink.Sink
+	Hooks       Hooks
+
+	// OnStats is called with the current stats every StatsInterval while the pipeline runs
+	OnStats       func(Stats)
+	StatsInterval time.Duration
+
+	stats *counters
+}
+
+// Stats returns a snapshot of the current stats, it is safe to be called while the pipeline runs
+func (p *Pipeline) Stats() Stats {
+	if p.stats == nil {
+		return Stats{Rejected: map[string]int{}}
+	}
+	return p.stats.snapshot()
+}
+
+// Run processes all lines until the fetcher is exhausted or ctx is done.
+// The sink is closed afterwards, the fetcher is not.
+func (p *Pipeline) Run(ctx context.Context) (Stats, error) {
+	p.stats = &counters{}
+
+	if p.OnStats != nil && p.StatsInterval > 0 {
+		t := time.NewTicker(p.StatsInterval)
+		done := make(chan struct{})
+		defer func() {
+			t.Stop()
+			close(done)
+		}()
+		go func() {
+			for {
+				select {
+				case <-t.C:
+					p.OnStats(p.Stats())
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	err := p.run(ctx)
+	if cerr := p.Sink.Close(); err == nil {
+		err = cerr
+	}
+	return p.Stats(), err
+}
+
+func (p *Pipeline) run(ctx context.Context) error {
+	pred := p.Filter
+	if pred == nil {
+		pred = filter.All{}
+	}
+	match := filter.Compile(pred)
+	prefilter := filter.RawLineFilter(pred)
+	pos, hasPos := p.Fetcher.(interface{ Position() (string, int) })
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, ok, err := p.Fetcher.Next(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		p.stats.read.Add(1)
+
+		// cheap check before the expensive parsing
+		if prefilter != nil {
+			if rule := prefilter(line); rule != "" {
+				p.stats.reject(rule)
+				continue
+			}
+		}
+
+		gl, skip, err := p.Transformer.Parse(line)
+		if err != nil {
+			if p.Hooks.OnParseError != nil {
+				p.Hooks.OnParseError(line, err)
+			}
+			p.stats.reject(ReasonParseError)
+			continue
+		}
+		if skip {
+			p.stats.reject(ReasonTransformerSkip)
+			continue
+		}
+		if hasPos {
+			gl.Source, gl.SourceLine = pos.Position()
+		}
+
+		for _, enrich := range p.Enrichers {
+			gl, err = enrich(gl)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !match(gl) {
+			rule := filter.RejectedBy(pred, gl)
+			p.stats.reject(rule)
+			continue
+		}
+
+		for _, normalize := range p.Normalizers {
+			gl, err = normalize(gl)
+			if err != nil {
+				return fmt.Errorf("could not normalize '%s': %w", line, err)
+			}
+			if gl == nil {
+				break
+			}
+		}
+		if gl == nil {
+			p.stats.reject(ReasonRewriteDrop)
+			continue
+		}
+
+		if p.Hooks.OnLine != nil {
+			p.Hooks.OnLine(gl)
+		}
+		if err := p.Sink.Write(gl); errors.Is(err, sink.ErrDuplicate) {
+			p.stats.reject(ReasonDuplicate)
+			continue
+		} else if err != nil {
+			return err
+		}
+		p.stats.included.Add(1)
+		p.stats.bytes.Add(gl.ResponseSize)
+	}
+}
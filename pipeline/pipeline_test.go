@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+
+	"github.com/floj/logs2goaccess/goaccess"
+	"github.com/floj/logs2goaccess/normalizer"
+)
+
+type sliceFetcher []string
+
+func (f *sliceFetcher) Next(ctx context.Context) (string, bool, error) {
+	if len(*f) == 0 {
+		return "", false, nil
+	}
+	line := (*f)[0]
+	*f = (*f)[1:]
+	return line, true, nil
+}
+
+func (f *sliceFetcher) Close() error { return nil }
+
+// pathTransformer parses lines consisting of the path only
+type pathTransformer struct{}
+
+func (pathTransformer) Parse(line string) (*goaccess.Line, bool, error) {
+	return &goaccess.Line{URL: line, ResponseSize: 10}, false, nil
+}
+
+type sliceSink []*goaccess.Line
+
+func (s *sliceSink) Write(l *goaccess.Line) error {
+	*s = append(*s, l)
+	return nil
+}
+
+func (s *sliceSink) Close() error { return nil }
+
+func TestRewriteDropIsRejected(t *testing.T) {
+	drop, err := normalizer.NewRewriteNormalizer([]normalizer.RewriteRule{
+		{Field: "path", Match: `^/health$`, Drop: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snk := &sliceSink{}
+	p := &Pipeline{
+		Fetcher:     &sliceFetcher{"/", "/health", "/about"},
+		Transformer: pathTransformer{},
+		Normalizers: []normalizer.Normalizer{drop},
+		Sink:        snk,
+	}
+	stat, err := p.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Read != 3 || stat.Included != 2 || stat.Skipped != 1 || stat.Bytes != 20 {
+		t.Errorf("got %+v", stat)
+	}
+	if stat.Rejected[ReasonRewriteDrop] != 1 {
+		t.Errorf("got rejections %v, want 1 %s", stat.Rejected, ReasonRewriteDrop)
+	}
+	if len(*snk) != 2 {
+		t.Errorf("got %d lines written, want 2", len(*snk))
+	}
+}
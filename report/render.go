@@ -0,0 +1,153 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+var writers = map[string]func(w io.Writer, r Report) error{
+	"table":    writeTable,
+	"json":     writeJSON,
+	"markdown": writeMarkdown,
+}
+
+// Formats returns the names of the formats supported by Write
+func Formats() []string {
+	names := []string{}
+	for n := range writers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Write writes the report in the named format
+func Write(w io.Writer, format string, r Report) error {
+	fn, set := writers[format]
+	if !set {
+		return fmt.Errorf("unknown report format '%s', known formats: %v", format, Formats())
+	}
+	return fn(w, r)
+}
+
+type section struct {
+	title   string
+	entries []Entry
+}
+
+func (r Report) sections() []section {
+	return []section{
+		{"vhosts", r.VHosts},
+		{"endpoints", r.Endpoints},
+		{"status classes", r.StatusClasses},
+		{"clients", r.Clients},
+		{"user agents", r.UserAgents},
+	}
+}
+
+// row formats the columns of an entry, latency columns are only added for entries which track it
+func (r Report) row(e Entry) []string {
+	share := 0.
+	if r.Requests > 0 {
+		share = 100 * float64(e.Requests) / float64(r.Requests)
+	}
+	// keys like user agents may contain tabs and newlines, which would break the columns
+	key := goaccess.Escape(e.Key)
+	if key == "" {
+		key = "-"
+	}
+	cols := []string{key, fmt.Sprint(e.Requests), fmt.Sprintf("%.1f%%", share), humanBytes(e.Bytes)}
+	if e.Latency != nil {
+		cols = append(cols, formatMs(e.Latency.P50), formatMs(e.Latency.P95), formatMs(e.Latency.P99))
+	}
+	return cols
+}
+
+func header(title string, entries []Entry) []string {
+	cols := []string{title, "requests", "share", "bytes"}
+	if len(entries) > 0 && entries[0].Latency != nil {
+		cols = append(cols, "p50", "p95", "p99")
+	}
+	return cols
+}
+
+func (r Report) overview() []string {
+	return []string{
+		fmt.Sprintf("%d requests, %s served", r.Requests, humanBytes(r.Bytes)),
+		fmt.Sprintf("from %s to %s", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339)),
+		fmt.Sprintf("latency p50 %s, p95 %s, p99 %s", formatMs(r.Latency.P50), formatMs(r.Latency.P95), formatMs(r.Latency.P99)),
+	}
+}
+
+func writeTable(w io.Writer, r Report) error {
+	for _, l := range r.overview() {
+		fmt.Fprintln(w, l)
+	}
+	for _, s := range r.sections() {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(header(s.title, s.entries), "\t"))
+		for _, e := range s.entries {
+			fmt.Fprintln(tw, strings.Join(r.row(e), "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMarkdown(w io.Writer, r Report) error {
+	fmt.Fprintln(w, "# Report")
+	fmt.Fprintln(w)
+	for _, l := range r.overview() {
+		fmt.Fprintf(w, "- %s\n", l)
+	}
+	for _, s := range r.sections() {
+		fmt.Fprintf(w, "\n## %s\n\n", s.title)
+		h := header(s.title, s.entries)
+		fmt.Fprintf(w, "| %s |\n", strings.Join(h, " | "))
+		fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(h)))
+		for _, e := range s.entries {
+			cols := r.row(e)
+			for i, c := range cols {
+				cols[i] = strings.ReplaceAll(c, "|", `\|`)
+			}
+			fmt.Fprintf(w, "| %s |\n", strings.Join(cols, " | "))
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, r Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func formatMs(ms float64) string {
+	if ms >= 1000 {
+		return fmt.Sprintf("%.2fs", ms/1000)
+	}
+	return fmt.Sprintf("%.1fms", ms)
+}
+
+func humanBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
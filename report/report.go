@@ -0,0 +1,175 @@
+package report
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+// Other collects the keys of a table once it holds MaxKeys keys
+const Other = "(other)"
+
+// Aggregator is a sink aggregating the lines in memory, see Report
+type Aggregator struct {
+	// MaxKeys limits the keys of each table, so unnormalized urls or many clients do not exhaust the memory
+	MaxKeys int
+
+	requests int64
+	bytes    int64
+	from, to time.Time
+	latency  *Sketch
+
+	vhosts        counter
+	endpoints     counter
+	statusClasses counter
+	clients       counter
+	userAgents    counter
+}
+
+// NewAggregator returns an aggregator with at most maxKeys keys per table
+func NewAggregator(maxKeys int) *Aggregator {
+	return &Aggregator{
+		MaxKeys:       maxKeys,
+		latency:       newLatencySketch(),
+		vhosts:        counter{},
+		endpoints:     counter{},
+		statusClasses: counter{},
+		clients:       counter{},
+		userAgents:    counter{},
+	}
+}
+
+func newLatencySketch() *Sketch {
+	return NewSketch(0.01)
+}
+
+type stats struct {
+	requests int64
+	bytes    int64
+	// only tracked for endpoints
+	latency *Sketch
+}
+
+type counter map[string]*stats
+
+func (c counter) add(key string, l *goaccess.Line, maxKeys int, withLatency bool) {
+	s, set := c[key]
+	if !set {
+		if maxKeys > 0 && len(c) >= maxKeys {
+			key = Other
+			s, set = c[key]
+		}
+		if !set {
+			s = &stats{}
+			if withLatency {
+				s.latency = newLatencySketch()
+			}
+			c[key] = s
+		}
+	}
+	s.requests++
+	s.bytes += l.ResponseSize
+	if s.latency != nil {
+		s.latency.Add(float64(l.RequestDuration) / float64(time.Millisecond))
+	}
+}
+
+func (a *Aggregator) Write(l *goaccess.Line) error {
+	a.requests++
+	a.bytes += l.ResponseSize
+	a.latency.Add(float64(l.RequestDuration) / float64(time.Millisecond))
+	if a.from.IsZero() || l.Timestamp.Before(a.from) {
+		a.from = l.Timestamp
+	}
+	if l.Timestamp.After(a.to) {
+		a.to = l.Timestamp
+	}
+
+	a.vhosts.add(l.VHost, l, a.MaxKeys, false)
+	a.endpoints.add(l.Method+" "+l.URL, l, a.MaxKeys, true)
+	a.statusClasses.add(strconv.Itoa(l.ResponseStatus/100)+"xx", l, a.MaxKeys, false)
+	a.clients.add(l.ClientIP, l, a.MaxKeys, false)
+	a.userAgents.add(l.UserAgent, l, a.MaxKeys, false)
+	return nil
+}
+
+func (a *Aggregator) Close() error {
+	return nil
+}
+
+// Report is the result of an Aggregator
+type Report struct {
+	Requests int64     `json:"requests"`
+	Bytes    int64     `json:"bytes"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Latency  Latency   `json:"latency"`
+
+	VHosts        []Entry `json:"vhosts"`
+	Endpoints     []Entry `json:"endpoints"`
+	StatusClasses []Entry `json:"statusClasses"`
+	Clients       []Entry `json:"clients"`
+	UserAgents    []Entry `json:"userAgents"`
+}
+
+// Entry is a row of a table of the report
+type Entry struct {
+	Key      string   `json:"key"`
+	Requests int64    `json:"requests"`
+	Bytes    int64    `json:"bytes"`
+	Latency  *Latency `json:"latency,omitempty"`
+}
+
+// Latency percentiles in milliseconds
+type Latency struct {
+	P50 float64 `json:"p50"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+}
+
+func latencyOf(s *Sketch) Latency {
+	return Latency{P50: s.Quantile(0.5), P95: s.Quantile(0.95), P99: s.Quantile(0.99)}
+}
+
+// Report returns the top entries of each table ordered by requests, status classes are all included
+func (a *Aggregator) Report(top int) Report {
+	r := Report{
+		Requests:      a.requests,
+		Bytes:         a.bytes,
+		From:          a.from,
+		To:            a.to,
+		Latency:       latencyOf(a.latency),
+		VHosts:        a.vhosts.top(top),
+		Endpoints:     a.endpoints.top(top),
+		StatusClasses: a.statusClasses.top(0),
+		Clients:       a.clients.top(top),
+		UserAgents:    a.userAgents.top(top),
+	}
+	sort.Slice(r.StatusClasses, func(i, j int) bool { return r.StatusClasses[i].Key < r.StatusClasses[j].Key })
+	return r
+}
+
+// top returns the n entries with the most requests, all if n is 0
+func (c counter) top(n int) []Entry {
+	entries := []Entry{}
+	for k, s := range c {
+		e := Entry{Key: k, Requests: s.requests, Bytes: s.bytes}
+		if s.latency != nil {
+			l := latencyOf(s.latency)
+			e.Latency = &l
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Requests != entries[j].Requests {
+			return entries[i].Requests > entries[j].Requests
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
@@ -0,0 +1,64 @@
+package report
+
+import (
+	"math"
+	"sort"
+)
+
+// Sketch estimates quantiles of a stream of positive values with a bounded relative error.
+// Values are counted in logarithmic buckets, so the memory only depends on the range of the values.
+type Sketch struct {
+	gamma   float64
+	logG    float64
+	buckets map[int]uint64
+	// values too small to be bucketed
+	zeros uint64
+	count uint64
+}
+
+// NewSketch returns a sketch whose quantiles are off by at most relativeAccuracy, e.g. 0.01
+func NewSketch(relativeAccuracy float64) *Sketch {
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &Sketch{gamma: gamma, logG: math.Log(gamma), buckets: map[int]uint64{}}
+}
+
+// minValue is the smallest value counted in a bucket, smaller values are counted as 0
+const minValue = 1e-9
+
+func (s *Sketch) Add(v float64) {
+	s.count++
+	if v < minValue {
+		s.zeros++
+		return
+	}
+	s.buckets[int(math.Ceil(math.Log(v)/s.logG))]++
+}
+
+func (s *Sketch) Count() uint64 {
+	return s.count
+}
+
+// Quantile returns the estimated value at q (0 <= q <= 1), 0 if nothing was added
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.count-1))
+	if rank < s.zeros {
+		return 0
+	}
+	keys := make([]int, 0, len(s.buckets))
+	for k := range s.buckets {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	seen := s.zeros
+	for _, k := range keys {
+		seen += s.buckets[k]
+		if seen > rank {
+			// the middle of the bucket (gamma^(k-1), gamma^k] has the lowest relative error
+			return 2 * math.Pow(s.gamma, float64(k)) / (1 + s.gamma)
+		}
+	}
+	return 2 * math.Pow(s.gamma, float64(keys[len(keys)-1])) / (1 + s.gamma)
+}
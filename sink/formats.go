@@ -0,0 +1,226 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+var factories = map[string]func(io.Writer) (Sink, error){
+	"goaccess": func(w io.Writer) (Sink, error) { return NewGoAccess(w), nil },
+	"json":     func(w io.Writer) (Sink, error) { return NewJSON(w), nil },
+	"csv":      func(w io.Writer) (Sink, error) { return NewCSV(w), nil },
+	"combined": func(w io.Writer) (Sink, error) { return NewCombined(w), nil },
+}
+
+// ForName returns the sink writing the named format to w
+func ForName(name string, w io.Writer) (Sink, error) {
+	fn, set := factories[name]
+	if !set {
+		names := []string{}
+		for n := range factories {
+			names = append(names, n)
+		}
+		return nil, fmt.Errorf("no sink for '%s' found. Known sinks: %v", name, names)
+	}
+	return fn(w)
+}
+
+// column is a named field of the structured formats
+type column struct {
+	name  string
+	value func(l *goaccess.Line) interface{}
+}
+
+var columns = []column{
+	{"timestamp", func(l *goaccess.Line) interface{} { return l.Timestamp.Format(time.RFC3339Nano) }},
+	{"vhost", func(l *goaccess.Line) interface{} { return l.VHost }},
+	{"username", func(l *goaccess.Line) interface{} { return l.Username }},
+	{"client_ip", func(l *goaccess.Line) interface{} { return l.ClientIP }},
+	{"method", func(l *goaccess.Line) interface{} { return l.Method }},
+	{"url", func(l *goaccess.Line) interface{} { return l.RequestURI() }},
+	{"protocol", func(l *goaccess.Line) interface{} { return l.Protocol }},
+	{"status", func(l *goaccess.Line) interface{} { return l.ResponseStatus }},
+	{"bytes", func(l *goaccess.Line) interface{} { return l.ResponseSize }},
+	{"referer", func(l *goaccess.Line) interface{} { return l.Referer }},
+	{"user_agent", func(l *goaccess.Line) interface{} { return l.UserAgent }},
+	{"tls_protocol", func(l *goaccess.Line) interface{} { return l.TLSProtocol }},
+	{"tls_cipher", func(l *goaccess.Line) interface{} { return l.TLSCipher }},
+	{"content_type", func(l *goaccess.Line) interface{} { return l.ContentType }},
+	{"cache_status", func(l *goaccess.Line) interface{} { return l.CacheStatus }},
+	{"duration_ms", func(l *goaccess.Line) interface{} { return float64(l.RequestDuration) / float64(time.Millisecond) }},
+	{"request_id", func(l *goaccess.Line) interface{} { return l.RequestID }},
+	{"forwarded_for", func(l *goaccess.Line) interface{} { return l.ForwardedFor }},
+	{"country", func(l *goaccess.Line) interface{} { return l.Country }},
+	{"asn", func(l *goaccess.Line) interface{} { return l.ASN }},
+	{"as_org", func(l *goaccess.Line) interface{} { return l.ASOrg }},
+}
+
+// JSON writes one JSON object per line (NDJSON)
+type JSON struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func NewJSON(w io.Writer) *JSON {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	return &JSON{w: bw, enc: enc}
+}
+
+func (s *JSON) Write(l *goaccess.Line) error {
+	// a map would lose the column order
+	obj := make(orderedObject, 0, len(columns))
+	for _, c := range columns {
+		obj = append(obj, keyValue{c.name, c.value(l)})
+	}
+	return s.enc.Encode(obj)
+}
+
+func (s *JSON) Close() error {
+	return s.w.Flush()
+}
+
+type keyValue struct {
+	key   string
+	value interface{}
+}
+
+type orderedObject []keyValue
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	// json.Marshal always escapes HTML, encode with the same setting as the sink
+	b := bytes.Buffer{}
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	b.WriteByte('{')
+	for i, kv := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if err := enc.Encode(kv.key); err != nil {
+			return nil, err
+		}
+		b.Truncate(b.Len() - 1)
+		b.WriteByte(':')
+		if err := enc.Encode(kv.value); err != nil {
+			return nil, err
+		}
+		b.Truncate(b.Len() - 1)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// CSV writes comma separated values with a header line
+type CSV struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func NewCSV(w io.Writer) *CSV {
+	return &CSV{w: csv.NewWriter(w)}
+}
+
+// SkipHeader omits the header line, e.g. when appending to a file which already has one
+func (s *CSV) SkipHeader() {
+	s.headerWritten = true
+}
+
+func (s *CSV) Write(l *goaccess.Line) error {
+	if !s.headerWritten {
+		header := []string{}
+		for _, c := range columns {
+			header = append(header, c.name)
+		}
+		if err := s.w.Write(header); err != nil {
+			return err
+		}
+		s.headerWritten = true
+	}
+	record := make([]string, 0, len(columns))
+	for _, c := range columns {
+		record = append(record, fmt.Sprint(c.value(l)))
+	}
+	return s.w.Write(record)
+}
+
+func (s *CSV) Close() error {
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// Combined writes the Apache/NCSA combined log format:
+// %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+type Combined struct {
+	w *bufio.Writer
+}
+
+func NewCombined(w io.Writer) *Combined {
+	return &Combined{w: bufio.NewWriter(w)}
+}
+
+const combinedTime = "02/Jan/2006:15:04:05 -0700"
+
+func (s *Combined) Write(l *goaccess.Line) error {
+	size := "-"
+	if l.ResponseSize > 0 {
+		size = strconv.FormatInt(l.ResponseSize, 10)
+	}
+	// parsers of the combined format expect a protocol in the request line
+	protocol := l.Protocol
+	if protocol == "" {
+		protocol = "HTTP/1.1"
+	}
+	_, err := fmt.Fprintf(s.w, "%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		orDash(l.ClientIP),
+		orDash(escapeCombined(l.Username)),
+		l.Timestamp.Format(combinedTime),
+		escapeCombined(l.Method),
+		escapeCombined(l.RequestURI()),
+		escapeCombined(protocol),
+		l.ResponseStatus,
+		size,
+		orDash(escapeCombined(l.Referer)),
+		orDash(escapeCombined(l.UserAgent)),
+	)
+	return err
+}
+
+func (s *Combined) Close() error {
+	return s.w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeCombined escapes quotes, backslashes and control characters like Apache does
+func escapeCombined(s string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,150 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/compress/gzip"
+	"github.com/parquet-go/parquet-go/compress/snappy"
+	"github.com/parquet-go/parquet-go/compress/uncompressed"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+// parquetRow mirrors goaccess.Line, columns with few distinct values are dictionary encoded
+type parquetRow struct {
+	Timestamp    int64             `parquet:"timestamp,timestamp(millisecond)"`
+	VHost        string            `parquet:"vhost,dict"`
+	Username     string            `parquet:"username"`
+	ClientIP     string            `parquet:"client_ip"`
+	Method       string            `parquet:"method,dict"`
+	Path         string            `parquet:"path"`
+	Query        string            `parquet:"query"`
+	Protocol     string            `parquet:"protocol,dict"`
+	Status       int32             `parquet:"status"`
+	Bytes        int64             `parquet:"bytes"`
+	Referer      string            `parquet:"referer"`
+	UserAgent    string            `parquet:"user_agent,dict"`
+	TLSProtocol  string            `parquet:"tls_protocol,dict"`
+	TLSCipher    string            `parquet:"tls_cipher,dict"`
+	ContentType  string            `parquet:"content_type,dict"`
+	CacheStatus  string            `parquet:"cache_status,dict"`
+	DurationMs   float64           `parquet:"duration_ms"`
+	RequestID    string            `parquet:"request_id"`
+	ForwardedFor string            `parquet:"forwarded_for"`
+	Country      string            `parquet:"country,dict"`
+	ASN          int64             `parquet:"asn"`
+	ASOrg        string            `parquet:"as_org,dict"`
+	Source       string            `parquet:"source,dict"`
+	SourceLine   int64             `parquet:"source_line"`
+	SourceFields map[string]string `parquet:"source_fields,optional"`
+}
+
+var parquetCodecs = map[string]compress.Codec{
+	"snappy": &snappy.Codec{},
+	"zstd":   &zstd.Codec{},
+	"gzip":   &gzip.Codec{},
+	"none":   &uncompressed.Codec{},
+}
+
+// ParquetCompressions returns the names of the supported compression codecs
+func ParquetCompressions() []string {
+	names := []string{}
+	for n := range parquetCodecs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParquetOptions configure the parquet files written
+type ParquetOptions struct {
+	// Compression is one of ParquetCompressions
+	Compression string
+	// RowGroupRows is the maximum number of rows per row group, all rows of a row group are
+	// buffered in memory
+	RowGroupRows int64
+}
+
+// Parquet writes the lines as a parquet file, the file is complete once Close was called.
+// Parquet files can not be appended to.
+type Parquet struct {
+	w    *parquet.GenericWriter[parquetRow]
+	rows []parquetRow
+}
+
+// parquetBatch is the number of rows handed to the writer at once
+const parquetBatch = 1024
+
+func NewParquet(w io.Writer, o ParquetOptions) (*Parquet, error) {
+	codec, set := parquetCodecs[o.Compression]
+	if !set {
+		return nil, fmt.Errorf("unknown parquet compression '%s', known: %v", o.Compression, ParquetCompressions())
+	}
+	opts := []parquet.WriterOption{
+		parquet.Compression(codec),
+		parquet.CreatedBy("logs2goaccess", "", ""),
+	}
+	if o.RowGroupRows > 0 {
+		opts = append(opts, parquet.MaxRowsPerRowGroup(o.RowGroupRows))
+	}
+	return &Parquet{
+		w:    parquet.NewGenericWriter[parquetRow](w, opts...),
+		rows: make([]parquetRow, 0, parquetBatch),
+	}, nil
+}
+
+func (s *Parquet) Write(l *goaccess.Line) error {
+	s.rows = append(s.rows, parquetRow{
+		Timestamp:    l.Timestamp.UnixMilli(),
+		VHost:        l.VHost,
+		Username:     l.Username,
+		ClientIP:     l.ClientIP,
+		Method:       l.Method,
+		Path:         l.URL,
+		Query:        l.Query,
+		Protocol:     l.Protocol,
+		Status:       int32(l.ResponseStatus),
+		Bytes:        l.ResponseSize,
+		Referer:      l.Referer,
+		UserAgent:    l.UserAgent,
+		TLSProtocol:  l.TLSProtocol,
+		TLSCipher:    l.TLSCipher,
+		ContentType:  l.ContentType,
+		CacheStatus:  l.CacheStatus,
+		DurationMs:   float64(l.RequestDuration) / float64(time.Millisecond),
+		RequestID:    l.RequestID,
+		ForwardedFor: l.ForwardedFor,
+		Country:      l.Country,
+		ASN:          int64(l.ASN),
+		ASOrg:        l.ASOrg,
+		Source:       l.Source,
+		SourceLine:   int64(l.SourceLine),
+		SourceFields: l.SourceFields,
+	})
+	if len(s.rows) < parquetBatch {
+		return nil
+	}
+	return s.flushRows()
+}
+
+func (s *Parquet) flushRows() error {
+	if len(s.rows) == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.rows)
+	s.rows = s.rows[:0]
+	return err
+}
+
+// Close writes the buffered rows and the footer, it does not close the underlying writer
+func (s *Parquet) Close() error {
+	if err := s.flushRows(); err != nil {
+		return err
+	}
+	return s.w.Close()
+}
@@ -0,0 +1,61 @@
+package sink
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+// ErrDuplicate is returned by sinks for lines they already contain, the line was not written again
+var ErrDuplicate = errors.New("duplicate line")
+
+// Sink receives the processed lines
+type Sink interface {
+	Write(l *goaccess.Line) error
+	// Close flushes all buffered lines and releases the resources the sink owns, like the files
+	// or databases it opened. A writer passed to the sink is not closed.
+	Close() error
+}
+
+// GoAccess writes lines in the tab separated format described by Layout
+type GoAccess struct {
+	w      *bufio.Writer
+	Layout goaccess.Layout
+	// OnEscaped is called with every formatted line which had fields that needed to be escaped
+	OnEscaped func(line string)
+	escaped   int
+}
+
+func NewGoAccess(w io.Writer) *GoAccess {
+	return &GoAccess{w: bufio.NewWriter(w), Layout: goaccess.DefaultLayout}
+}
+
+func (s *GoAccess) Write(l *goaccess.Line) error {
+	line, escaped := s.Layout.Format(l)
+	if escaped {
+		s.escaped++
+		if s.OnEscaped != nil {
+			s.OnEscaped(line)
+		}
+	}
+	if _, err := s.w.WriteString(line); err != nil {
+		return err
+	}
+	return s.w.WriteByte('\n')
+}
+
+// Escaped returns the number of lines written which had fields that needed to be escaped
+func (s *GoAccess) Escaped() int {
+	return s.escaped
+}
+
+// Flush writes the buffered lines to the underlying writer
+func (s *GoAccess) Flush() error {
+	return s.w.Flush()
+}
+
+func (s *GoAccess) Close() error {
+	return s.w.Flush()
+}
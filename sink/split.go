@@ -0,0 +1,262 @@
+package sink
+
+import (
+	"compress/gzip"
+	"container/list"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+)
+
+// placeholders of the path template
+var splitPlaceholders = map[string]func(l *goaccess.Line) string{
+	"vhost":        func(l *goaccess.Line) string { return sanitizePathSegment(l.VHost) },
+	"date":         func(l *goaccess.Line) string { return l.Timestamp.Format("2006-01-02") },
+	"hour":         func(l *goaccess.Line) string { return l.Timestamp.Format("15") },
+	"status_class": func(l *goaccess.Line) string { return strconv.Itoa(l.ResponseStatus/100) + "xx" },
+}
+
+// SplitKeys are the values of --out-split-by and the placeholders the path template needs for them
+var SplitKeys = map[string][]string{
+	"vhost":        {"vhost"},
+	"day":          {"date"},
+	"hour":         {"date", "hour"},
+	"status-class": {"status_class"},
+}
+
+// partPlaceholder is replaced when the file is opened, so files are never appended to
+const partPlaceholder = "part"
+
+// Split writes the lines into separate files, the path of a line is rendered from a template like
+// out/{vhost}/{date}.log.gz. Paths ending in .gz are gzip compressed. At most maxOpen files are
+// kept open, the least recently used one is closed if another one has to be opened and is
+// appended to when it is needed again. If the template contains {part}, a new file with the next
+// part number is created instead, for formats like parquet which can not be appended to. Unlike
+// other sinks, Close closes the files.
+type Split struct {
+	// literal text and placeholders alternating, starting with text
+	template []string
+	maxOpen  int
+	// append to existing files instead of truncating them when they are opened the first time
+	appendFiles bool
+	newSink     func(w io.Writer, appending bool) (Sink, error)
+
+	// most recently used first
+	lru   *list.List
+	open  map[string]*list.Element
+	known map[string]bool
+	// next part number by path
+	parts map[string]int
+	// prefix of the part numbers, so parts of different runs do not overwrite each other
+	runID string
+
+	escaped int
+}
+
+type splitFile struct {
+	path string
+	f    *os.File
+	gz   *gzip.Writer
+	s    Sink
+}
+
+// NewSplit returns a sink splitting the lines by the keys (see SplitKeys) into the files given by
+// template. newSink creates the sink for each opened file, appending is set if the file is reopened.
+func NewSplit(template string, by []string, maxOpen int, appendFiles bool, newSink func(w io.Writer, appending bool) (Sink, error)) (*Split, error) {
+	parts, err := parseSplitTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range by {
+		required, set := SplitKeys[k]
+		if !set {
+			keys := []string{}
+			for k := range SplitKeys {
+				keys = append(keys, k)
+			}
+			return nil, fmt.Errorf("unknown split key '%s', known keys: %v", k, keys)
+		}
+		for _, p := range required {
+			if !strings.Contains(template, "{"+p+"}") {
+				return nil, fmt.Errorf("splitting by %s requires {%s} in the path '%s'", k, p, template)
+			}
+		}
+	}
+	if maxOpen < 1 {
+		return nil, fmt.Errorf("at least one file has to be kept open, got %d", maxOpen)
+	}
+	return &Split{
+		template:    parts,
+		maxOpen:     maxOpen,
+		appendFiles: appendFiles,
+		newSink:     newSink,
+		lru:         list.New(),
+		open:        map[string]*list.Element{},
+		known:       map[string]bool{},
+		parts:       map[string]int{},
+		runID:       time.Now().UTC().Format("20060102T150405"),
+	}, nil
+}
+
+func parseSplitTemplate(template string) ([]string, error) {
+	parts := []string{}
+	rest := template
+	for {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			return append(parts, rest), nil
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in '%s'", template)
+		}
+		name := rest[start+1 : start+end]
+		if _, set := splitPlaceholders[name]; !set && name != partPlaceholder {
+			return nil, fmt.Errorf("unknown placeholder {%s} in '%s', known placeholders: {vhost}, {date}, {hour}, {status_class}, {part}", name, template)
+		}
+		parts = append(parts, rest[:start], name)
+		rest = rest[start+end+1:]
+	}
+}
+
+func (s *Split) path(l *goaccess.Line) string {
+	b := strings.Builder{}
+	for i, p := range s.template {
+		if i%2 == 0 {
+			b.WriteString(p)
+			continue
+		}
+		if p == partPlaceholder {
+			b.WriteString("{" + partPlaceholder + "}")
+			continue
+		}
+		b.WriteString(splitPlaceholders[p](l))
+	}
+	return b.String()
+}
+
+func (s *Split) Write(l *goaccess.Line) error {
+	path := s.path(l)
+	if e, set := s.open[path]; set {
+		s.lru.MoveToFront(e)
+		return e.Value.(*splitFile).s.Write(l)
+	}
+
+	for s.lru.Len() >= s.maxOpen {
+		if err := s.closeFile(s.lru.Back()); err != nil {
+			return err
+		}
+	}
+	sf, err := s.openFile(path)
+	if err != nil {
+		return err
+	}
+	s.open[path] = s.lru.PushFront(sf)
+	return sf.s.Write(l)
+}
+
+func (s *Split) openFile(path string) (*splitFile, error) {
+	name := path
+	appending := s.known[path] || s.appendFiles
+	mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if strings.Contains(path, "{"+partPlaceholder+"}") {
+		name = strings.ReplaceAll(path, "{"+partPlaceholder+"}", fmt.Sprintf("%s-%04d", s.runID, s.parts[path]))
+		s.parts[path]++
+		appending = false
+		mode = os.O_CREATE | os.O_WRONLY | os.O_EXCL
+	} else if appending {
+		mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(name, mode, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.known[path] = true
+
+	sf := &splitFile{path: path, f: f}
+	var w io.Writer = f
+	// appending to a gzip file adds another member, which gzip readers handle transparently
+	if strings.ToLower(filepath.Ext(path)) == ".gz" {
+		sf.gz = gzip.NewWriter(f)
+		w = sf.gz
+	}
+	// only files with content need no header
+	if appending {
+		if fi, err := f.Stat(); err == nil && fi.Size() == 0 {
+			appending = false
+		}
+	}
+	sf.s, err = s.newSink(w, appending)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return sf, nil
+}
+
+func (s *Split) closeFile(e *list.Element) error {
+	sf := s.lru.Remove(e).(*splitFile)
+	delete(s.open, sf.path)
+	if ec, ok := sf.s.(interface{ Escaped() int }); ok {
+		s.escaped += ec.Escaped()
+	}
+	err := sf.s.Close()
+	if sf.gz != nil {
+		if gerr := sf.gz.Close(); err == nil {
+			err = gerr
+		}
+	}
+	if ferr := sf.f.Close(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return fmt.Errorf("closing %s failed: %w", sf.f.Name(), err)
+	}
+	return nil
+}
+
+// Close flushes and closes all open files
+func (s *Split) Close() error {
+	var err error
+	for s.lru.Len() > 0 {
+		if cerr := s.closeFile(s.lru.Front()); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Escaped returns the number of lines written which had fields that needed to be escaped, if
+// the sinks of the files count them
+func (s *Split) Escaped() int {
+	n := s.escaped
+	for e := s.lru.Front(); e != nil; e = e.Next() {
+		if ec, ok := e.Value.(*splitFile).s.(interface{ Escaped() int }); ok {
+			n += ec.Escaped()
+		}
+	}
+	return n
+}
+
+// sanitizePathSegment makes sure values like vhosts can not escape the output directory
+func sanitizePathSegment(s string) string {
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == ':':
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,158 @@
+package sink
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/floj/logs2goaccess/goaccess"
+	// pure Go, no cgo required
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS requests (
+	id            INTEGER PRIMARY KEY,
+	ts            TEXT    NOT NULL,
+	vhost         TEXT    NOT NULL,
+	username      TEXT    NOT NULL,
+	client_ip     TEXT    NOT NULL,
+	method        TEXT    NOT NULL,
+	path          TEXT    NOT NULL,
+	query         TEXT    NOT NULL,
+	protocol      TEXT    NOT NULL,
+	status        INTEGER NOT NULL,
+	bytes         INTEGER NOT NULL,
+	referer       TEXT    NOT NULL,
+	user_agent    TEXT    NOT NULL,
+	tls_protocol  TEXT    NOT NULL,
+	tls_cipher    TEXT    NOT NULL,
+	content_type  TEXT    NOT NULL,
+	cache_status  TEXT    NOT NULL,
+	duration_ms   REAL    NOT NULL,
+	request_id    TEXT    NOT NULL,
+	forwarded_for TEXT    NOT NULL,
+	country       TEXT    NOT NULL,
+	asn           INTEGER NOT NULL,
+	as_org        TEXT    NOT NULL,
+	source        TEXT,
+	source_line   INTEGER,
+	UNIQUE (source, source_line)
+);
+CREATE INDEX IF NOT EXISTS requests_ts ON requests (ts);
+CREATE INDEX IF NOT EXISTS requests_vhost ON requests (vhost);
+CREATE INDEX IF NOT EXISTS requests_status ON requests (status);
+`
+
+// lines already in the database are ignored, other constraint violations still fail. Lines without a
+// source are never deduplicated as NULLs are distinct.
+const sqliteInsert = `
+INSERT INTO requests (
+	ts, vhost, username, client_ip, method, path, query, protocol, status, bytes, referer, user_agent,
+	tls_protocol, tls_cipher, content_type, cache_status, duration_ms, request_id, forwarded_for,
+	country, asn, as_org, source, source_line
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (source, source_line) DO NOTHING`
+
+// sqliteTime is understood by the date and time functions of SQLite and sorts chronologically
+const sqliteTime = "2006-01-02 15:04:05.000"
+
+// SQLite writes the lines into the requests table of a SQLite database. Lines are inserted in
+// transactions of BatchSize lines. Unlike other sinks, Close closes the database.
+type SQLite struct {
+	BatchSize int
+
+	db      *sql.DB
+	tx      *sql.Tx
+	stmt    *sql.Stmt
+	pending int
+}
+
+// NewSQLite opens or creates the database at path. Unless appending, existing requests are deleted.
+// When appending, lines already read from the same source location are skipped.
+func NewSQLite(path string, appending bool) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// a single connection, so the pragmas apply to all statements
+	db.SetMaxOpenConns(1)
+	for _, q := range []string{"PRAGMA journal_mode = WAL", "PRAGMA synchronous = NORMAL", sqliteSchema} {
+		if _, err := db.Exec(q); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("could not prepare %s: %w", path, err)
+		}
+	}
+	if !appending {
+		if _, err := db.Exec("DELETE FROM requests"); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return &SQLite{BatchSize: 10000, db: db}, nil
+}
+
+func (s *SQLite) Write(l *goaccess.Line) error {
+	if s.tx == nil {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare(sqliteInsert)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		s.tx, s.stmt = tx, stmt
+	}
+
+	var source sql.NullString
+	var sourceLine sql.NullInt64
+	if l.Source != "" {
+		source = sql.NullString{String: l.Source, Valid: true}
+		sourceLine = sql.NullInt64{Int64: int64(l.SourceLine), Valid: true}
+	}
+	res, err := s.stmt.Exec(
+		l.Timestamp.UTC().Format(sqliteTime), l.VHost, l.Username, l.ClientIP, l.Method, l.URL, l.Query,
+		l.Protocol, l.ResponseStatus, l.ResponseSize, l.Referer, l.UserAgent, l.TLSProtocol, l.TLSCipher,
+		l.ContentType, l.CacheStatus, float64(l.RequestDuration)/float64(time.Millisecond), l.RequestID,
+		l.ForwardedFor, l.Country, int64(l.ASN), l.ASOrg, source, sourceLine,
+	)
+	if err != nil {
+		return err
+	}
+	duplicate := false
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		duplicate = true
+	}
+
+	s.pending++
+	if s.pending >= s.BatchSize {
+		if err := s.commit(); err != nil {
+			return err
+		}
+	}
+	if duplicate {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+func (s *SQLite) commit() error {
+	if s.tx == nil {
+		return nil
+	}
+	s.stmt.Close()
+	err := s.tx.Commit()
+	s.tx, s.stmt, s.pending = nil, nil, 0
+	return err
+}
+
+// Close commits the pending lines and closes the database
+func (s *SQLite) Close() error {
+	err := s.commit()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
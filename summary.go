@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/floj/logs2goaccess/fetcher"
+	"github.com/floj/logs2goaccess/pipeline"
+)
+
+type summary struct {
+	Read     int            `json:"read"`
+	Included int            `json:"included"`
+	Skipped  int            `json:"skipped"`
+	Bytes    int64          `json:"bytes"`
+	Duration string         `json:"duration"`
+	Rejected map[string]int `json:"rejected"`
+	// locations skipped because they could not be read
+	SkippedLocations []skippedLocation `json:"skippedLocations,omitempty"`
+	// only set if the counts are scaled back up by the sample rate
+	ScaledIncluded *int64 `json:"scaledIncluded,omitempty"`
+	ScaledBytes    *int64 `json:"scaledBytes,omitempty"`
+	// only set with --validate-output, lines with fields that had to be escaped
+	Escaped *int `json:"escaped,omitempty"`
+}
+
+type skippedLocation struct {
+	Location string `json:"location"`
+	Error    string `json:"error"`
+}
+
+func printSummary(w io.Writer, format string, stat pipeline.Stats, skipped []fetcher.SkippedLocation, escaped *int, d time.Duration, scale float64) error {
+	s := summary{
+		Read:     stat.Read,
+		Included: stat.Included,
+		Skipped:  stat.Skipped,
+		Bytes:    stat.Bytes,
+		Duration: d.String(),
+		Rejected: stat.Rejected,
+		Escaped:  escaped,
+	}
+	for _, sl := range skipped {
+		s.SkippedLocations = append(s.SkippedLocations, skippedLocation{Location: sl.Location, Error: sl.Err.Error()})
+	}
+	if scale != 1 {
+		included := int64(float64(stat.Included) * scale)
+		bytes := int64(float64(stat.Bytes) * scale)
+		s.ScaledIncluded = &included
+		s.ScaledBytes = &bytes
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+
+	fmt.Fprintf(w, "%d lines read in %s, %d included (%d bytes)\n", s.Read, s.Duration, s.Included, s.Bytes)
+	if s.ScaledIncluded != nil {
+		fmt.Fprintf(w, "scaled by sample rate: ~%d included (~%d bytes)\n", *s.ScaledIncluded, *s.ScaledBytes)
+	}
+	if s.Escaped != nil {
+		fmt.Fprintf(w, "%d lines had fields which needed to be escaped\n", *s.Escaped)
+	}
+	if len(s.SkippedLocations) > 0 {
+		fmt.Fprintf(w, "%d locations skipped:\n", len(s.SkippedLocations))
+		for _, sl := range s.SkippedLocations {
+			fmt.Fprintf(w, "  %s: %s\n", sl.Location, sl.Error)
+		}
+	}
+	if len(s.Rejected) == 0 {
+		return nil
+	}
+
+	reasons := []string{}
+	for r := range s.Rejected {
+		reasons = append(reasons, r)
+	}
+	// most rejections first
+	sort.Slice(reasons, func(i, j int) bool {
+		if s.Rejected[reasons[i]] != s.Rejected[reasons[j]] {
+			return s.Rejected[reasons[i]] > s.Rejected[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "skipped by\tlines\tshare")
+	for _, r := range reasons {
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\n", r, s.Rejected[r], 100*float64(s.Rejected[r])/float64(s.Read))
+	}
+	return tw.Flush()
+}
@@ -9,9 +9,21 @@ import (
 	"time"
 
 	"github.com/floj/logs2goaccess/goaccess"
+	"github.com/floj/logs2goaccess/transformer/clientip"
+	"github.com/floj/logs2goaccess/transformer/utils"
 )
 
 type Parser struct {
+	ClientIP         *clientip.Resolver
+	KeepSourceFields bool
+}
+
+var fieldNames = []string{
+	"type", "time", "elb", "client:port", "target:port", "request_processing_time", "target_processing_time",
+	"response_processing_time", "elb_status_code", "target_status_code", "received_bytes", "sent_bytes",
+	"request", "user_agent", "ssl_cipher", "ssl_protocol", "target_group_arn", "trace_id", "domain_name",
+	"chosen_cert_arn", "matched_rule_priority", "request_creation_time", "actions_executed", "redirect_url",
+	"error_reason", "target:port_list", "target_status_code_list", "classification", "classification_reason",
 }
 
 // Modified version of bufio.ScanWords either splits on words or sentences in quotes
@@ -67,10 +79,11 @@ func (p *Parser) Parse(text string) (*goaccess.Line, bool, error) {
 		return nil, false, err
 	}
 
-	clientIP, _, err := net.SplitHostPort(fields[3])
-	if err != nil {
+	if _, _, err := net.SplitHostPort(fields[3]); err != nil {
 		return nil, false, err
 	}
+	// the ALB does not log any forwarding headers, the client is the TCP peer
+	clientIP := p.ClientIP.Resolve(fields[3], nil)
 
 	reqParts := strings.Split(fields[12], " ")
 	uri, err := url.Parse(reqParts[1])
@@ -94,24 +107,33 @@ func (p *Parser) Parse(text string) (*goaccess.Line, bool, error) {
 		return nil, false, err
 	}
 
-	path := uri.EscapedPath()
-	if uri.RawQuery != "" {
-		path = path + "?" + uri.RawQuery
+	protocol := ""
+	if len(reqParts) > 2 {
+		protocol = reqParts[2]
 	}
 
-	return &goaccess.Line{
+	l := &goaccess.Line{
 		Timestamp:       ts,
 		VHost:           fields[18],
 		ClientIP:        clientIP,
 		Method:          reqParts[0],
-		URL:             path,
+		URL:             uri.EscapedPath(),
+		Query:           uri.RawQuery,
+		Protocol:        protocol,
 		ResponseStatus:  int(respStatus),
 		ResponseSize:    int64(respSize),
 		Referer:         "",
 		UserAgent:       fields[13],
+		TLSProtocol:     dashToEmpty(fields[15]),
+		TLSCipher:       dashToEmpty(fields[14]),
 		ContentType:     "",
 		RequestDuration: respTime,
-	}, false, nil
+		RequestID:       fields[17],
+	}
+	if p.KeepSourceFields {
+		l.SourceFields = utils.NamedFields(fieldNames, fields)
+	}
+	return l, false, nil
 }
 
 func sumTimes(s ...string) (time.Duration, error) {
@@ -125,3 +147,10 @@ func sumTimes(s ...string) (time.Duration, error) {
 	}
 	return time.Duration(secs * float64(time.Second)), nil
 }
+
+func dashToEmpty(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
@@ -1,17 +1,20 @@
 package caddy
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"mime"
-	"net"
 	"strings"
 	"time"
 
 	"github.com/floj/logs2goaccess/goaccess"
+	"github.com/floj/logs2goaccess/transformer/clientip"
 	"github.com/floj/logs2goaccess/transformer/utils"
 )
 
 type Parser struct {
+	ClientIP         *clientip.Resolver
+	KeepSourceFields bool
 }
 
 func (p *Parser) Parse(text string) (*goaccess.Line, bool, error) {
@@ -25,30 +28,97 @@ func (p *Parser) Parse(text string) (*goaccess.Line, bool, error) {
 	reqHeaders := utils.HeadersFromMap(cl.Request.Headers)
 	respHeaders := utils.HeadersFromMap(cl.RespHeaders)
 
-	clientIP, _, _ := net.SplitHostPort(cl.Request.RemoteAddr)
-	if xff := reqHeaders.Get("x-forwarded-for"); xff != "" {
-		parts := strings.Split(xff, ",")
-		clientIP = strings.TrimSpace(parts[len(parts)-1])
-	}
+	clientIP := p.ClientIP.Resolve(cl.Request.RemoteAddr, reqHeaders)
 
 	contentType := ""
 	ctHeader := respHeaders.Get("content-type")
 	if ctHeader != "" {
 		contentType, _, _ = mime.ParseMediaType(respHeaders.Get("content-type"))
 	}
-	return &goaccess.Line{
+	tlsProtocol, tlsCipher := "", ""
+	if cl.Request.TLS.Version != 0 {
+		tlsProtocol = tlsVersionName(uint16(cl.Request.TLS.Version))
+		tlsCipher = cipherSuiteName(uint16(cl.Request.TLS.CipherSuite))
+	}
+
+	l := &goaccess.Line{
 		Timestamp:       time.Unix(int64(cl.Ts), 0),
 		VHost:           cl.Request.Host,
 		ClientIP:        clientIP,
 		Method:          cl.Request.Method,
-		URL:             cl.Request.URI,
+		Protocol:        cl.Request.Proto,
 		ResponseStatus:  cl.Status,
 		ResponseSize:    int64(cl.Size),
 		Referer:         reqHeaders.Get("referer"),
 		UserAgent:       reqHeaders.Get("user-agent"),
+		TLSProtocol:     tlsProtocol,
+		TLSCipher:       tlsCipher,
 		ContentType:     contentType,
+		CacheStatus:     utils.CacheStatus(respHeaders),
 		RequestDuration: time.Duration(cl.Duration * float64(time.Second)),
-	}, false, nil
+		RequestID:       reqHeaders.Get("x-request-id"),
+		ForwardedFor:    strings.Join(reqHeaders.Values("x-forwarded-for"), ", "),
+	}
+	l.SetRequestURI(cl.Request.URI)
+	if p.KeepSourceFields {
+		raw := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(text), &raw); err != nil {
+			return nil, false, err
+		}
+		l.SourceFields = map[string]string{}
+		utils.Flatten("", raw, l.SourceFields)
+	}
+	return l, false, nil
+}
+
+// tlsVersionName uses the names OpenSSL uses, like the ALB and CloudFront logs do
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLSv1"
+	case tls.VersionTLS11:
+		return "TLSv1.1"
+	case tls.VersionTLS12:
+		return "TLSv1.2"
+	case tls.VersionTLS13:
+		return "TLSv1.3"
+	}
+	return tls.VersionName(v)
+}
+
+// openSSLCipherNames maps the TLS 1.2 and older cipher suites supported by Go to the names OpenSSL
+// uses, like the ALB and CloudFront logs do. TLS 1.3 suites have the same name in both.
+var openSSLCipherNames = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                      "RC4-SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:                 "DES-CBC3-SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:                  "AES128-SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:                  "AES256-SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:               "AES128-SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:               "AES128-GCM-SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:               "AES256-GCM-SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:              "ECDHE-ECDSA-RC4-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:          "ECDHE-ECDSA-AES128-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:          "ECDHE-ECDSA-AES256-SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:                "ECDHE-RSA-RC4-SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:           "ECDHE-RSA-DES-CBC3-SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:            "ECDHE-RSA-AES128-SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:            "ECDHE-RSA-AES256-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256:       "ECDHE-ECDSA-AES128-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:         "ECDHE-RSA-AES128-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:         "ECDHE-RSA-AES128-GCM-SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:       "ECDHE-ECDSA-AES128-GCM-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:         "ECDHE-RSA-AES256-GCM-SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:       "ECDHE-ECDSA-AES256-GCM-SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:   "ECDHE-RSA-CHACHA20-POLY1305",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256: "ECDHE-ECDSA-CHACHA20-POLY1305",
+}
+
+// cipherSuiteName uses the names OpenSSL uses, like the ALB and CloudFront logs do
+func cipherSuiteName(id uint16) string {
+	if name, ok := openSSLCipherNames[id]; ok {
+		return name
+	}
+	return tls.CipherSuiteName(id)
 }
 
 type caddyLog struct {
@@ -0,0 +1,142 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultHeaders are used if no headers are configured
+var DefaultHeaders = []string{"X-Forwarded-For"}
+
+// Resolver finds the client ip of a request which might have passed through proxies.
+// Forwarding headers are only considered if the peer is a trusted proxy, the chain is then
+// walked right-to-left and the first untrusted hop is taken as the client.
+// A nil Resolver always returns the peer.
+type Resolver struct {
+	trusted []*net.IPNet
+	headers []string
+	// OnUntrustedHeader is called if a request has a forwarding header but no proxies are trusted,
+	// so the header is ignored and the proxy is taken as the client
+	OnUntrustedHeader func(peer, header string)
+}
+
+// New creates a resolver trusting the given proxies (CIDRs or single ips). The headers
+// (X-Forwarded-For, Forwarded, X-Real-IP, CF-Connecting-IP, ...) are tried in order, the first
+// one present is used.
+func New(trustedProxies []string, headers []string) (*Resolver, error) {
+	r := &Resolver{headers: headers}
+	if len(r.headers) == 0 {
+		r.headers = DefaultHeaders
+	}
+	for _, p := range trustedProxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("'%s' is neither a valid ip nor a CIDR", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			r.trusted = append(r.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a valid CIDR: %w", p, err)
+		}
+		r.trusted = append(r.trusted, n)
+	}
+	return r, nil
+}
+
+// Resolve returns the client ip for a request received from peer (with or without port) with the given headers.
+// Headers might be nil for formats which don't log them.
+func (r *Resolver) Resolve(peer string, h http.Header) string {
+	peer = stripPort(peer)
+	if r == nil {
+		return peer
+	}
+	if !r.isTrusted(peer) {
+		if len(r.trusted) == 0 && r.OnUntrustedHeader != nil {
+			for _, name := range r.headers {
+				if h.Get(name) != "" {
+					r.OnUntrustedHeader(peer, name)
+					break
+				}
+			}
+		}
+		return peer
+	}
+	for _, name := range r.headers {
+		values := h.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		chain := []string{}
+		for _, v := range values {
+			chain = append(chain, parseHeader(name, v)...)
+		}
+		return r.walk(append(chain, peer))
+	}
+	return peer
+}
+
+// walk returns the first untrusted hop from the right, or the leftmost one if all are trusted
+func (r *Resolver) walk(chain []string) string {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !r.isTrusted(chain[i]) {
+			return chain[i]
+		}
+	}
+	return chain[0]
+}
+
+func (r *Resolver) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range r.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseHeader(name, v string) []string {
+	hops := []string{}
+	for _, e := range strings.Split(v, ",") {
+		e = strings.TrimSpace(e)
+		if strings.EqualFold(name, "Forwarded") {
+			e = forwardedFor(e)
+		}
+		if e == "" {
+			continue
+		}
+		hops = append(hops, stripPort(e))
+	}
+	return hops
+}
+
+// forwardedFor extracts the for= parameter of a Forwarded header element (RFC 7239)
+func forwardedFor(elem string) string {
+	for _, pair := range strings.Split(elem, ";") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+			return strings.Trim(kv[1], `"`)
+		}
+	}
+	return ""
+}
+
+// stripPort removes the port from ip:port and [ipv6]:port, plain ips are returned as is
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
@@ -1,15 +1,29 @@
 package cloudfront
 
 import (
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/floj/logs2goaccess/goaccess"
+	"github.com/floj/logs2goaccess/transformer/clientip"
+	"github.com/floj/logs2goaccess/transformer/utils"
 )
 
 type Parser struct {
+	ClientIP         *clientip.Resolver
+	KeepSourceFields bool
+}
+
+var fieldNames = []string{
+	"date", "time", "x-edge-location", "sc-bytes", "c-ip", "cs-method", "cs(Host)", "cs-uri-stem", "sc-status",
+	"cs(Referer)", "cs(User-Agent)", "cs-uri-query", "cs(Cookie)", "x-edge-result-type", "x-edge-request-id",
+	"x-host-header", "cs-protocol", "cs-bytes", "time-taken", "x-forwarded-for", "ssl-protocol", "ssl-cipher",
+	"x-edge-response-result-type", "cs-protocol-version", "fle-status", "fle-encrypted-fields", "c-port",
+	"time-to-first-byte", "x-edge-detailed-result-type", "sc-content-type", "sc-content-len", "sc-range-start",
+	"sc-range-end",
 }
 
 func (p *Parser) Parse(text string) (*goaccess.Line, bool, error) {
@@ -40,32 +54,70 @@ func (p *Parser) Parse(text string) (*goaccess.Line, bool, error) {
 		return nil, false, err
 	}
 
-	path := fields[7]
-	if fields[11] != "-" && fields[11] != "" {
-		path = path + "?" + fields[11]
+	protocol := ""
+	if len(fields) > 23 {
+		protocol = dashToEmpty(fields[23])
 	}
 
-	contentType, err := url.PathUnescape(fields[19])
-	if err != nil {
-		return nil, true, err
+	contentType := ""
+	if len(fields) > 29 {
+		contentType, err = url.PathUnescape(fields[29])
+		if err != nil {
+			return nil, true, err
+		}
 	}
 
+	// x-forwarded-for holds the viewer if the request was sent through a proxy
+	var headers http.Header
+	xff := dashToEmpty(fields[19])
+	if xff != "" {
+		headers = http.Header{"X-Forwarded-For": []string{xff}}
+	}
+	clientIP := p.ClientIP.Resolve(fields[4], headers)
+
 	userAgent, err := url.PathUnescape(fields[10])
 	if err != nil {
 		return nil, true, err
 	}
 
-	return &goaccess.Line{
+	l := &goaccess.Line{
 		Timestamp:       ts,
 		VHost:           fields[15],
-		ClientIP:        fields[4],
+		ClientIP:        clientIP,
 		Method:          fields[5],
-		URL:             path,
+		URL:             fields[7],
+		Query:           dashToEmpty(fields[11]),
+		Protocol:        protocol,
 		ResponseStatus:  int(respStatus),
 		ResponseSize:    int64(respSize),
 		Referer:         fields[9],
-		UserAgent:       strings.ReplaceAll(userAgent, "\n", "\\n"),
-		ContentType:     strings.ReplaceAll(contentType, "\n", "\\n"),
+		UserAgent:       userAgent,
+		TLSProtocol:     dashToEmpty(fields[20]),
+		TLSCipher:       dashToEmpty(fields[21]),
+		ContentType:     contentType,
+		CacheStatus:     cacheStatuses[fields[13]],
 		RequestDuration: time.Duration(respTime * float64(time.Second)),
-	}, false, nil
+		RequestID:       fields[14],
+		ForwardedFor:    xff,
+	}
+	if p.KeepSourceFields {
+		l.SourceFields = utils.NamedFields(fieldNames, fields)
+	}
+	return l, false, nil
+}
+
+// cacheStatuses maps x-edge-result-type to the cache states known by goaccess,
+// errors, redirects and exceeded limits have no cache state
+var cacheStatuses = map[string]string{
+	"Hit":             "HIT",
+	"OriginShieldHit": "HIT",
+	"RefreshHit":      "REVALIDATED",
+	"Miss":            "MISS",
+}
+
+func dashToEmpty(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/floj/logs2goaccess/goaccess"
 	"github.com/floj/logs2goaccess/transformer/alb"
 	"github.com/floj/logs2goaccess/transformer/caddy"
+	"github.com/floj/logs2goaccess/transformer/clientip"
 	"github.com/floj/logs2goaccess/transformer/cloudfront"
 )
 
@@ -13,13 +14,27 @@ type Transformer interface {
 	Parse(line string) (*goaccess.Line, bool, error)
 }
 
-var factories = map[string]func() (Transformer, error){
-	"caddy":          func() (Transformer, error) { return &caddy.Parser{}, nil },
-	"aws:cloudfront": func() (Transformer, error) { return &cloudfront.Parser{}, nil },
-	"aws:alb":        func() (Transformer, error) { return &alb.Parser{}, nil },
+// Options are shared by all transformers
+type Options struct {
+	// ClientIP resolves the client ip of requests which passed through proxies
+	ClientIP *clientip.Resolver
+	// KeepSourceFields keeps the fields of the original log line in goaccess.Line.SourceFields
+	KeepSourceFields bool
 }
 
-func ForName(name string) (Transformer, error) {
+var factories = map[string]func(Options) (Transformer, error){
+	"caddy": func(o Options) (Transformer, error) {
+		return &caddy.Parser{ClientIP: o.ClientIP, KeepSourceFields: o.KeepSourceFields}, nil
+	},
+	"aws:cloudfront": func(o Options) (Transformer, error) {
+		return &cloudfront.Parser{ClientIP: o.ClientIP, KeepSourceFields: o.KeepSourceFields}, nil
+	},
+	"aws:alb": func(o Options) (Transformer, error) {
+		return &alb.Parser{ClientIP: o.ClientIP, KeepSourceFields: o.KeepSourceFields}, nil
+	},
+}
+
+func ForName(name string, opts Options) (Transformer, error) {
 	fn, set := factories[name]
 	if !set {
 		names := []string{}
@@ -28,5 +43,5 @@ func ForName(name string) (Transformer, error) {
 		}
 		return nil, fmt.Errorf("no transformer for '%s' found. Known transformers: %v", name, names)
 	}
-	return fn()
+	return fn(opts)
 }
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CacheStatus maps the Cache-Status (RFC 9211) or X-Cache response header to the cache states
+// known by goaccess, it returns an empty string if neither is present or the state is unknown
+func CacheStatus(h http.Header) string {
+	if cs := h.Get("Cache-Status"); cs != "" {
+		return cacheStatusFromRFC9211(cs)
+	}
+	xc := strings.ToUpper(h.Get("X-Cache"))
+	switch {
+	case xc == "":
+		return ""
+	case strings.Contains(xc, "REFRESHHIT"), strings.Contains(xc, "REVALIDATED"):
+		return "REVALIDATED"
+	case strings.Contains(xc, "STALE"):
+		return "STALE"
+	case strings.Contains(xc, "HIT"):
+		return "HIT"
+	case strings.Contains(xc, "MISS"):
+		return "MISS"
+	case strings.Contains(xc, "BYPASS"), strings.Contains(xc, "PASS"):
+		return "BYPASS"
+	case strings.Contains(xc, "EXPIRED"):
+		return "EXPIRED"
+	}
+	return ""
+}
+
+// cacheStatusFromRFC9211 uses the cache closest to the origin, e.g. "ExampleCache; hit, CDN; fwd=uri-miss"
+func cacheStatusFromRFC9211(v string) string {
+	entries := strings.Split(v, ",")
+	params := strings.Split(entries[0], ";")
+	for _, p := range params[1:] {
+		k, val, _ := strings.Cut(strings.TrimSpace(p), "=")
+		switch strings.ToLower(k) {
+		case "hit":
+			return "HIT"
+		case "fwd":
+			switch strings.ToLower(strings.Trim(val, `"`)) {
+			case "stale":
+				return "EXPIRED"
+			case "bypass", "method", "request":
+				return "BYPASS"
+			case "uri-miss", "vary-miss", "miss":
+				return "MISS"
+			}
+		}
+	}
+	return ""
+}
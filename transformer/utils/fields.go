@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NamedFields maps the values to their names, values without a name are keyed by their index
+func NamedFields(names []string, values []string) map[string]string {
+	m := make(map[string]string, len(values))
+	for i, v := range values {
+		if i < len(names) {
+			m[names[i]] = v
+			continue
+		}
+		m[fmt.Sprintf("field_%d", i)] = v
+	}
+	return m
+}
+
+// Flatten adds the leaves of a decoded JSON value to into, keyed by their path joined by dots.
+// Lists of values are joined by commas.
+func Flatten(prefix string, v interface{}, into map[string]string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			Flatten(k, e, into)
+		}
+	case []interface{}:
+		values := []string{}
+		for _, e := range t {
+			switch e.(type) {
+			case map[string]interface{}, []interface{}:
+				m := map[string]string{}
+				Flatten("", e, m)
+				values = append(values, fmt.Sprint(m))
+			default:
+				values = append(values, fmt.Sprint(e))
+			}
+		}
+		into[prefix] = strings.Join(values, ", ")
+	case nil:
+		into[prefix] = ""
+	default:
+		into[prefix] = fmt.Sprint(t)
+	}
+}